@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"ray8118/httpfromtcp/internal/request"
+	"ray8118/httpfromtcp/request"
 )
 
 func main() {
@@ -33,8 +33,12 @@ func main() {
 		r.Headers.ForEach(func(n, v string) {
 			fmt.Printf("- %s  %s\n", n, v)
 		})
+		body, err := r.ReadBody()
+		if err != nil {
+			log.Fatal("error", "error", err)
+		}
 		fmt.Printf("Body:\n")
-		fmt.Printf("%s\n", r.Body)
+		fmt.Printf("%s\n", body)
 	}
 
 }
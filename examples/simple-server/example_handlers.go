@@ -9,9 +9,8 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"ray8118/httpfromtcp/internal/headers"
-	"ray8118/httpfromtcp/internal/request"
-	"ray8118/httpfromtcp/internal/response"
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
 )
 
 type UserData struct {
@@ -55,7 +54,7 @@ func handleVideo(w *response.Writer, r *request.Request) {
 
 	// 3. Write the status and headers.
 	h := response.GetDefaultHeaders(int(fileSize)) // Note: This might need adjustment if fileSize is very large
-	h.Replace("content-type", "video/mp4")
+	h.Set("Content-Type", "video/mp4")
 	w.WriteStatusLine(response.StatusOk)
 	w.WriteHeaders(*h)
 
@@ -88,16 +87,18 @@ func handleHelloUser(w *response.Writer, r *request.Request) {
 		name = "stranger"
 	}
 
-	body := []byte("Hello " + name)
-	h := response.GetDefaultHeaders(len(body))
-	w.WriteStatusLine(response.StatusOk)
-	w.WriteHeaders(*h)
-	w.WriteBody(body)
+	// The writer sends a 200 and works out the Content-Length on its own.
+	w.WriteBody([]byte("Hello " + name))
 }
 
 func handleCreateMessage(w *response.Writer, r *request.Request) {
 	// For a POST request, we read the body
-	message := r.Body
+	data, err := r.ReadBody()
+	if err != nil {
+		response.Respond400(w)
+		return
+	}
+	message := string(data)
 
 	log.Printf("Received new message: %s", message)
 
@@ -119,10 +120,6 @@ func handleQueryTest(w *response.Writer, r *request.Request) {
 		}
 	}
 
-	w.WriteStatusLine(response.StatusOk)
-	h := response.GetDefaultHeaders(len(body))
-	h.Replace("Content-Type", "text/plain")
-	w.WriteHeaders(*h)
 	w.WriteBody([]byte(body))
 }
 
@@ -137,7 +134,7 @@ func handlerUserJSON(w *response.Writer, r *request.Request) {
 func handleCreateUser(w *response.Writer, r *request.Request) {
 	var reqBody CreateUserRequest
 
-	err := json.Unmarshal([]byte(r.Body), &reqBody)
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
 		errorResponse := map[string]string{"error": "Invalid request body"}
 		w.JSON(400, errorResponse)
@@ -159,32 +156,28 @@ func handleHttpbin(w *response.Writer, r *request.Request) {
 		response.Respond500(w)
 		return
 	}
+	defer res.Body.Close()
 
-	h := response.GetDefaultHeaders(0)
-	h.Delete("Content-length")
-	h.Set("transfer-encoding", "chunked")
-	h.Replace("content-type", "text/plain")
-	h.Set("Trailer", "X-Content-SHA256")
-	h.Set("Trailer", "X-Content-Length")
-	w.WriteStatusLine(response.StatusOk)
-	w.WriteHeaders(*h)
+	// Declaring trailers makes the writer send the body chunked and append
+	// the trailer fields once the handler returns.
+	w.DeclareTrailer("X-Content-SHA256", "X-Content-Length")
+	w.Header().Set("Content-Type", "text/plain")
 
 	fullBody := []byte{}
 	for {
 		data := make([]byte, 32)
 		n, err := res.Body.Read(data)
+		if n > 0 {
+			fullBody = append(fullBody, data[:n]...)
+			w.WriteBody(data[:n])
+			w.Flush()
+		}
 		if err != nil {
 			break
 		}
-		fullBody = append(fullBody, data[:n]...)
-		w.WriteBody(fmt.Appendf(nil, "%x\r\n", n))
-		w.WriteBody(data[:n])
-		w.WriteBody([]byte("\r\n"))
 	}
-	w.WriteBody([]byte("0\r\n"))
-	tailers := headers.NewHeaders()
+
 	out := sha256.Sum256(fullBody)
-	tailers.Set("X-Content-SHA256", hex.EncodeToString(out[:]))
-	tailers.Set("X-Content-Length", fmt.Sprintf("%d", len(fullBody)))
-	w.WriteHeaders(*tailers)
+	w.Trailers().Set("X-Content-SHA256", hex.EncodeToString(out[:]))
+	w.Trailers().Set("X-Content-Length", fmt.Sprintf("%d", len(fullBody)))
 }
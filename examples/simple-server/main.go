@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"ray8118/httpfromtcp"
-	"ray8118/httpfromtcp/internal/mux"
-	"ray8118/httpfromtcp/internal/static"
+	"ray8118/httpfromtcp/mux"
+	"ray8118/httpfromtcp/static"
 )
 
 const addr = ":42069"
 
+// shutdownTimeout bounds how long the server waits for in-flight requests
+// after receiving SIGINT or SIGTERM.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	// Create a new mux from our library
 	m := mux.NewMux()
@@ -23,20 +32,41 @@ func main() {
 	m.HandleFunc("GET", "/query-test", handleQueryTest)
 	m.HandleFunc("GET", "/user", handlerUserJSON)
 	m.HandleFunc("POST", "/user", handleCreateUser)
-	m.HandleFunc("GET", "/static", static.Static)
+	m.HandleFunc("GET", "/static/{path...}", static.Static)
 
 	m.HandleFunc("GET", "/httpbin/get", handleHttpbin)
 	m.HandleFunc("GET", "/httpbin/ip", handleHttpbin)
 	m.HandleFunc("GET", "/httpbin/user-agent", handleHttpbin)
 
-	log.Printf("Starting server on %s", addr)
-
 	// Chain the middleware to the mux's ServeHTTP method.
-	chainedHandler := mux.Chain(m.ServeHTTP, mux.LoggingMiddleware)
+	// The mux is itself a Handler, and so is the chain wrapped around it.
+	chainedHandler := mux.Chain(m, mux.LoggingMiddleware, mux.RecoveryMiddleware)
 
-	// Convert the resulting HandlerFunc back into a Handler that ListenAndServe can accept.
-	err := httpfromtcp.ListenAndServe(addr, httpfromtcp.HandlerFunc(chainedHandler))
+	server := &httpfromtcp.Server{
+		Addr:              addr,
+		Handler:           chainedHandler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadBodyTimeout:   60 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+	bound, err := server.Start()
 	if err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
+	log.Printf("Server started on %s", bound)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	log.Println("Shutting down, waiting for in-flight requests...")
+
+	// Give in-flight requests a bounded amount of time to finish before the
+	// remaining connections are dropped.
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Fatalf("Shutdown: %v", err)
+	}
+	log.Println("Server gracefully stopped")
 }
@@ -0,0 +1,193 @@
+// Package headers implements an ordered, multi-valued list of HTTP header
+// fields and its wire-format parser.
+package headers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+func isToken(str string) bool {
+	for _, ch := range str {
+		found := false
+		if ch >= 'A' && ch <= 'Z' ||
+			ch >= 'a' && ch <= 'z' ||
+			ch >= '0' && ch <= '9' {
+			found = true
+		}
+		switch ch {
+		case '!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~':
+			found = true
+		}
+
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+var rn = []byte("\r\n")
+
+var ErrorMalformedFieldLine = fmt.Errorf("malformed field line")
+var ErrorMalformedFieldName = fmt.Errorf("malformed field name")
+var ErrorMalformedFieldValue = fmt.Errorf("malformed field value")
+var ErrorObsoleteLineFolding = fmt.Errorf("obsolete line folding")
+
+// parseHeader splits a field line into its name and value. Anything a
+// server and a proxy in front of it might read differently is rejected
+// rather than guessed at: line folding, whitespace before the colon, and
+// control characters such as a bare CR or LF in the value.
+func parseHeader(fieldLine []byte) (string, string, error) {
+	if fieldLine[0] == ' ' || fieldLine[0] == '\t' {
+		return "", "", ErrorObsoleteLineFolding
+	}
+	name, value, ok := bytes.Cut(fieldLine, []byte(":"))
+	if !ok {
+		return "", "", ErrorMalformedFieldLine
+	}
+	if len(name) == 0 || !isToken(string(name)) {
+		return "", "", ErrorMalformedFieldName
+	}
+
+	value = bytes.Trim(value, " \t")
+	for _, c := range value {
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return "", "", ErrorMalformedFieldValue
+		}
+	}
+
+	return string(name), string(value), nil
+}
+
+// field is a single header field line, with its name as it was received or
+// set.
+type field struct {
+	name  string
+	value string
+}
+
+// Headers is an ordered list of header fields. Names are matched
+// case-insensitively but keep their original casing, and a name may appear
+// more than once (e.g. Set-Cookie).
+type Headers struct {
+	fields []field
+}
+
+func NewHeaders() *Headers {
+	return &Headers{}
+}
+
+// Get returns the first value stored under name.
+func (h *Headers) Get(name string) (string, bool) {
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, name) {
+			return f.value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns every value stored under name, in order.
+func (h *Headers) Values(name string) []string {
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, name) {
+			values = append(values, f.value)
+		}
+	}
+	return values
+}
+
+// Add appends a field, keeping any existing values for name.
+func (h *Headers) Add(name, value string) {
+	h.fields = append(h.fields, field{name: name, value: value})
+}
+
+// Set replaces every value stored under name with value. The field keeps the
+// position of the first existing occurrence, or is appended if there is none.
+func (h *Headers) Set(name, value string) {
+	for i, f := range h.fields {
+		if strings.EqualFold(f.name, name) {
+			h.fields[i] = field{name: name, value: value}
+			h.deleteFrom(i+1, name)
+			return
+		}
+	}
+	h.Add(name, value)
+}
+
+// Delete removes every value stored under name.
+func (h *Headers) Delete(name string) {
+	h.deleteFrom(0, name)
+}
+
+// deleteFrom removes the fields named name at or after index start.
+func (h *Headers) deleteFrom(start int, name string) {
+	kept := h.fields[:start]
+	for _, f := range h.fields[start:] {
+		if !strings.EqualFold(f.name, name) {
+			kept = append(kept, f)
+		}
+	}
+	h.fields = kept
+}
+
+// Len returns the number of fields.
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
+
+// HasToken reports whether any of the comma-separated lists stored under
+// name contains token, compared case-insensitively (e.g. "close" in
+// "Connection: close").
+func (h *Headers) HasToken(name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ForEach calls cb for every field, in order, with the name's original casing.
+func (h *Headers) ForEach(cb func(n, v string)) {
+	for _, f := range h.fields {
+		cb(f.name, f.value)
+	}
+}
+
+func (h *Headers) Parse(data []byte) (int, bool, error) {
+	read := 0
+	done := false
+
+	for {
+		idx := bytes.IndexByte(data[read:], '\n')
+		if idx == -1 {
+			break
+		}
+		// A bare LF ends the line for some parsers and not for others.
+		if idx == 0 || data[read+idx-1] != '\r' {
+			return 0, false, ErrorMalformedFieldLine
+		}
+		idx--
+
+		if idx == 0 {
+			done = true
+			read += len(rn)
+			break
+		}
+
+		name, value, err := parseHeader(data[read : read+idx])
+		if err != nil {
+			return 0, false, err
+		}
+		read += idx + len(rn)
+		h.Add(name, value)
+
+	}
+	return read, done, nil
+}
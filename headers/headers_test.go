@@ -0,0 +1,119 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderParse(t *testing.T) {
+	// Test: Valid single header
+	headers := NewHeaders()
+	data := []byte("Host: localhost:42069\r\nFooFoo: barbar\r\n")
+	n, done, err := headers.Parse(data)
+	require.NoError(t, err)
+	require.NotNil(t, headers)
+	host, ok := headers.Get("HOST")
+	assert.True(t, ok)
+	assert.Equal(t, "localhost:42069", host)
+
+	foofoo, ok := headers.Get("FooFoo")
+	assert.Equal(t, "barbar", foofoo)
+
+	host, ok = headers.Get("MissingKey")
+	assert.False(t, ok)
+	assert.Equal(t, "", host)
+	assert.Equal(t, 39, n)
+	assert.False(t, done)
+
+	// Test: Invalid spacing header
+	headers = NewHeaders()
+	data = []byte("       Host : localhost:42069       \r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	headers = NewHeaders()
+	data = []byte("H©st: localhost:42069\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	headers = NewHeaders()
+	data = []byte("Host: localhost:42069\r\nHost: localhost:42069\r\n")
+	n, done, err = headers.Parse(data)
+	require.NoError(t, err)
+	require.NotNil(t, headers)
+	host, ok = headers.Get("HOST")
+	assert.Equal(t, "localhost:42069", host)
+	assert.Equal(t, []string{"localhost:42069", "localhost:42069"}, headers.Values("host"))
+	assert.False(t, done)
+}
+
+func TestHeaderParseStrict(t *testing.T) {
+	// Test: Lines a proxy might read differently are rejected
+	for data, want := range map[string]error{
+		"Host: a\r\n  folded\r\n\r\n":        ErrorObsoleteLineFolding,
+		"\tHost: a\r\n\r\n":                  ErrorObsoleteLineFolding,
+		"Host : a\r\n\r\n":                   ErrorMalformedFieldName,
+		"Host\t: a\r\n\r\n":                  ErrorMalformedFieldName,
+		": a\r\n\r\n":                        ErrorMalformedFieldName,
+		"Host a\r\n\r\n":                     ErrorMalformedFieldLine,
+		"Host: a\nContent-Length: 5\r\n\r\n": ErrorMalformedFieldLine,
+		"Host: a\n":                          ErrorMalformedFieldLine,
+		"Host: a\r\n\n":                      ErrorMalformedFieldLine,
+		"Host: a\rContent-Length: 5\r\n\r\n": ErrorMalformedFieldValue,
+		"Host: a\x00b\r\n\r\n":               ErrorMalformedFieldValue,
+	} {
+		n, _, err := NewHeaders().Parse([]byte(data))
+		assert.ErrorIs(t, err, want, "%q", data)
+		assert.Equal(t, 0, n)
+	}
+
+	// Test: Tabs around and inside values are fine
+	headers := NewHeaders()
+	_, done, err := headers.Parse([]byte("X-Tab:\ta\tb \r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, done)
+	value, _ := headers.Get("x-tab")
+	assert.Equal(t, "a\tb", value)
+}
+
+func TestHeaderOrder(t *testing.T) {
+	// Test: Parsed fields keep their order and casing
+	headers := NewHeaders()
+	data := []byte("Host: localhost\r\nSet-Cookie: a=1\r\nX-Trace-ID: abc\r\nset-cookie: b=2\r\n\r\n")
+	_, done, err := headers.Parse(data)
+	require.NoError(t, err)
+	assert.True(t, done)
+	var lines []string
+	headers.ForEach(func(n, v string) {
+		lines = append(lines, n+": "+v)
+	})
+	assert.Equal(t, []string{"Host: localhost", "Set-Cookie: a=1", "X-Trace-ID: abc", "set-cookie: b=2"}, lines)
+	assert.Equal(t, []string{"a=1", "b=2"}, headers.Values("SET-COOKIE"))
+
+	// Test: Set replaces every value in place of the first
+	headers.Set("Set-Cookie", "c=3")
+	lines = nil
+	headers.ForEach(func(n, v string) {
+		lines = append(lines, n+": "+v)
+	})
+	assert.Equal(t, []string{"Host: localhost", "Set-Cookie: c=3", "X-Trace-ID: abc"}, lines)
+
+	// Test: Add appends, Delete removes all values
+	headers.Add("Set-Cookie", "d=4")
+	assert.Equal(t, []string{"c=3", "d=4"}, headers.Values("set-cookie"))
+	headers.Delete("set-cookie")
+	assert.Nil(t, headers.Values("Set-Cookie"))
+	assert.Equal(t, 2, headers.Len())
+
+	// Test: HasToken looks through every value
+	headers.Add("Connection", "keep-alive")
+	headers.Add("Connection", "Upgrade, close")
+	assert.True(t, headers.HasToken("connection", "close"))
+	assert.False(t, headers.HasToken("connection", "te"))
+}
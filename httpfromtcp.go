@@ -1,51 +1,260 @@
+// Package httpfromtcp is an HTTP/1.1 server built directly on TCP. It
+// provides the Server, ListenAndServe and the Handler type; routing,
+// requests and responses live in the mux, request and response subpackages.
 package httpfromtcp
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
 	"log"
-	"os"
-	"os/signal"
-	"ray8118/httpfromtcp/internal/request"
-	"ray8118/httpfromtcp/internal/response"
+	"net"
 	"ray8118/httpfromtcp/internal/server"
-	"syscall"
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Handler is an interface that objects can implement to be a request handler.
-type Handler interface {
-	ServeHTTP(w *response.Writer, r *request.Request)
-}
+// It is the same type the mux, its middleware and the server use.
+type Handler = response.Handler
 
 // HandlerFunc is an adapter to allow the use of ordinary functions as HTTP handlers.
 // If f is a function with the appropriate signature, HandlerFunc(f) is a
 // Handler that calls f.
-type HandlerFunc func(w *response.Writer, r *request.Request)
+type HandlerFunc = response.HandlerFunc
+
+// ConnState is the state of a client connection, as reported to the
+// Server.ConnState hook.
+type ConnState = server.ConnState
+
+const (
+	StateNew    = server.StateNew
+	StateActive = server.StateActive
+	StateIdle   = server.StateIdle
+	StateClosed = server.StateClosed
+)
+
+// ErrorServerClosed is returned by Serve and ListenAndServe once Shutdown or
+// Close has been called.
+var ErrorServerClosed = server.ErrorServerClosed
+
+// Connection timeouts used by the package-level ListenAndServe. They keep a
+// slow or silent client from holding a connection open indefinitely.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadBodyTimeout   = 60 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+)
+
+// Server is an HTTP server. Its fields must be set before it starts serving
+// and not changed afterwards. The zero value is usable once Handler is set,
+// though it applies no timeouts.
+type Server struct {
+	// Addr is the TCP address to listen on, such as "127.0.0.1:8080",
+	// "[::1]:80" or "localhost:0", or a Unix domain socket path prefixed
+	// with "unix:", such as "unix:/run/app.sock". When empty, ":http" is used.
+	Addr    string
+	Handler Handler
+	// UnixSocket controls the socket file created for a "unix:" Addr.
+	UnixSocket UnixSocketOptions
+
+	// Timeouts; zero disables each one. See the server package's Config for
+	// what exactly each one covers.
+	ReadHeaderTimeout time.Duration
+	ReadBodyTimeout   time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// Size limits for incoming requests; zero selects the request package
+	// defaults.
+	MaxRequestLineBytes int
+	MaxHeaderBytes      int
+	MaxHeaderCount      int
+	MaxBodyBytes        int
+	// MaxPipelinedRequests caps how many requests in a row a client may
+	// send without waiting for a response; zero selects a default of 32.
+	MaxPipelinedRequests int
+
+	// ExpectContinue, if set, decides whether a request sent with
+	// "Expect: 100-continue" may go on to send its body. Returning any
+	// status other than StatusContinue (or zero), such as 417 or 413,
+	// rejects the request with that status before the body is sent.
+	ExpectContinue func(*request.Request) response.StatusCode
+
+	// ErrorLog receives errors from accepting connections, unparseable
+	// requests and recovered panics. When nil, the log package's standard
+	// logger is used.
+	ErrorLog *log.Logger
+	// ConnState, if set, is called whenever a client connection changes
+	// state.
+	ConnState func(net.Conn, ConnState)
 
-// ServeHTTP calls f(w, r).
-func (f HandlerFunc) ServeHTTP(w *response.Writer, r *request.Request) {
-	f(w, r)
+	// TLSConfig is used by ServeTLS and ListenAndServeTLS. It may be nil
+	// when certificate files are passed to them instead.
+	TLSConfig *tls.Config
+
+	once sync.Once
+	srv  *server.Server
+
+	// mu guards stoppers, cleanups such as certificate watchers that run
+	// when the server stops.
+	mu       sync.Mutex
+	stoppers []func()
 }
 
-// ListenAndServe starts an HTTP server with a given address and handler.
-func ListenAndServe(addr string, handler Handler) error {
-	var port uint16
-	if _, err := fmt.Sscanf(addr, ":%d", &port); err != nil {
-		return fmt.Errorf("invalid address format: %s", addr)
+// server returns the underlying server, creating it from the fields on
+// first use.
+func (s *Server) server() *server.Server {
+	s.once.Do(func() {
+		s.srv = server.New(s.Handler, server.Config{
+			ReadHeaderTimeout:    s.ReadHeaderTimeout,
+			ReadBodyTimeout:      s.ReadBodyTimeout,
+			WriteTimeout:         s.WriteTimeout,
+			IdleTimeout:          s.IdleTimeout,
+			MaxRequestLineBytes:  s.MaxRequestLineBytes,
+			MaxHeaderBytes:       s.MaxHeaderBytes,
+			MaxHeaderCount:       s.MaxHeaderCount,
+			MaxBodyBytes:         s.MaxBodyBytes,
+			MaxPipelinedRequests: s.MaxPipelinedRequests,
+			ExpectContinue:       s.ExpectContinue,
+			ErrorLog:             s.ErrorLog,
+			ConnState:            s.ConnState,
+		})
+	})
+	return s.srv
+}
+
+// listen opens the listener for Addr, or for defaultAddr if Addr is empty.
+func (s *Server) listen(defaultAddr string) (net.Listener, error) {
+	addr := s.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	if path, ok := strings.CutPrefix(addr, unixAddrPrefix); ok {
+		return ListenUnix(path, s.UnixSocket)
 	}
+	return net.Listen("tcp", addr)
+}
 
-	// We pass the handler's ServeHTTP method to the internal server.
-	s, err := server.Serve(port, handler.ServeHTTP)
+// ListenAndServe listens on Addr and serves requests until the server is
+// shut down, then returns ErrorServerClosed.
+func (s *Server) ListenAndServe() error {
+	l, err := s.listen(":http")
 	if err != nil {
 		return err
 	}
-	defer s.Close()
-	log.Printf("Server started on port %d", port)
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l, which may be any listener, and serves
+// them until the server is shut down, then returns ErrorServerClosed. It
+// takes ownership of l and closes it on return.
+func (s *Server) Serve(l net.Listener) error {
+	return s.server().Serve(l)
+}
+
+// ServeListeners serves on every listener at once, such as those returned
+// by SystemdListeners. It returns when all of them have stopped, with the
+// first error other than ErrorServerClosed, if any; such an error also
+// closes the server.
+func (s *Server) ServeListeners(listeners []net.Listener) error {
+	if len(listeners) == 0 {
+		return ErrorNoListeners
+	}
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() {
+			err := s.Serve(l)
+			if err != ErrorServerClosed {
+				s.Close()
+			}
+			errs <- err
+		}()
+	}
+	result := ErrorServerClosed
+	for range listeners {
+		if err := <-errs; err != ErrorServerClosed && result == ErrorServerClosed {
+			result = err
+		}
+	}
+	return result
+}
+
+// Start listens on Addr and serves requests in the background. It returns
+// the address actually bound, which tells callers the port chosen for an
+// Addr ending in ":0". Errors that end serving later go to ErrorLog.
+func (s *Server) Start() (net.Addr, error) {
+	l, err := s.listen(":http")
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := s.Serve(l); err != ErrorServerClosed {
+			s.logf("Serve on %s stopped: %v", l.Addr(), err)
+		}
+	}()
+	return l.Addr(), nil
+}
+
+// Shutdown gracefully stops the server: it stops accepting connections,
+// closes idle ones and waits for requests in flight to finish. If ctx
+// expires first, the remaining connections are closed and ctx's error is
+// returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stop()
+	return s.server().Shutdown(ctx)
+}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+// Close immediately stops the server, dropping every connection including
+// those with requests in flight.
+func (s *Server) Close() error {
+	s.stop()
+	return s.server().Close()
+}
 
-	<-sigChan
-	log.Println("Server gracefully stopped")
+// onStop registers f to run when the server is shut down or closed.
+func (s *Server) onStop(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stoppers = append(s.stoppers, f)
+}
 
-	return nil
-}
\ No newline at end of file
+func (s *Server) stop() {
+	s.mu.Lock()
+	stoppers := s.stoppers
+	s.stoppers = nil
+	s.mu.Unlock()
+	for _, f := range stoppers {
+		f()
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// ListenAndServe listens on addr and serves requests with handler, using
+// conservative default timeouts. It blocks until serving fails. Applications
+// that need graceful shutdown or other settings should use a Server.
+func ListenAndServe(addr string, handler Handler) error {
+	return newDefaultServer(addr, handler).ListenAndServe()
+}
+
+// newDefaultServer returns the server behind the package-level functions.
+func newDefaultServer(addr string, handler Handler) *Server {
+	return &Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ReadBodyTimeout:   defaultReadBodyTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+	}
+}
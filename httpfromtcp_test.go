@@ -0,0 +1,61 @@
+package httpfromtcp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	s := &Server{
+		Addr: "127.0.0.1:0",
+		Handler: HandlerFunc(func(w *response.Writer, r *request.Request) {
+			w.WriteBody([]byte("hello"))
+		}),
+	}
+
+	// Test: Port 0 binds a free port, reported by Start
+	addr, err := s.Start()
+	require.NoError(t, err)
+	assert.NotEqual(t, 0, addr.(*net.TCPAddr).Port)
+
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Shutdown stops Serve on other listeners too
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.ErrorIs(t, <-served, ErrorServerClosed)
+
+	// Test: Addresses other than ":port" are accepted
+	for _, addr := range []string{"localhost:0", "[::1]:0"} {
+		s := &Server{Addr: addr, Handler: s.Handler}
+		bound, err := s.Start()
+		if addr == "[::1]:0" && err != nil {
+			t.Skip("IPv6 loopback not available")
+		}
+		require.NoError(t, err, addr)
+		assert.NotNil(t, bound)
+		require.NoError(t, s.Close())
+	}
+}
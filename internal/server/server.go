@@ -1,88 +1,583 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"ray8118/httpfromtcp/internal/request"
-	"ray8118/httpfromtcp/internal/response"
+	"os"
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Handler is the function signature for a request handler. It takes a response writer
-// and a pointer to the parsed request.
-type Handler func(w *response.Writer, req *request.Request)
+// defaultMaxPipelinedRequests is the pipelining cap used when
+// Config.MaxPipelinedRequests is zero.
+const defaultMaxPipelinedRequests = 32
+
+// minAcceptBackoff and maxAcceptBackoff bound how long Serve waits before
+// retrying after a temporary accept error, such as running out of file
+// descriptors. The wait doubles with each failure in a row.
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// newConnGracePeriod is how long Shutdown lets a freshly accepted connection
+// deliver its first request, which may still be on its way or held up by a
+// TLS handshake, before closing it as idle.
+const newConnGracePeriod = 5 * time.Second
+
+// shutdownPollInterval is how often Shutdown checks whether the in-flight
+// requests have finished.
+const shutdownPollInterval = 50 * time.Millisecond
+
+var ErrorServerClosed = fmt.Errorf("server closed")
+
+// ConnState is the state of a client connection, as reported to the
+// Config.ConnState hook.
+type ConnState int
+
+const (
+	// StateNew is a connection that has just been accepted and has not sent
+	// a request yet.
+	StateNew ConnState = iota
+	// StateActive is a connection that is reading a request or running its
+	// handler.
+	StateActive
+	// StateIdle is a kept-alive connection waiting for its next request.
+	StateIdle
+	// StateClosed is a connection that has been closed. It is the last
+	// state reported for a connection.
+	StateClosed
+)
+
+var connStateNames = map[ConnState]string{
+	StateNew:    "new",
+	StateActive: "active",
+	StateIdle:   "idle",
+	StateClosed: "closed",
+}
+
+func (c ConnState) String() string {
+	return connStateNames[c]
+}
+
+// Config holds the tunable settings of a Server. A zero duration disables the
+// corresponding timeout.
+type Config struct {
+	// ReadHeaderTimeout bounds how long a client may take to send the request
+	// line and headers. Clients that miss it receive a 408 Request Timeout.
+	ReadHeaderTimeout time.Duration
+	// ReadBodyTimeout bounds how long reading the request body may take once
+	// the headers have arrived, including time the handler spends before
+	// reading it.
+	ReadBodyTimeout time.Duration
+	// WriteTimeout bounds how long writing the response may take, measured
+	// from the end of the request.
+	WriteTimeout time.Duration
+	// IdleTimeout bounds how long a kept-alive connection may wait for its
+	// next request. When zero, ReadHeaderTimeout is used instead.
+	IdleTimeout time.Duration
+
+	// Size limits passed on to the request parser. Zero selects the
+	// request package defaults. Requests that exceed them are answered with
+	// 414, 431 or 413 respectively. A chunked body only turns out too large
+	// while the handler reads it; the read fails with
+	// request.ErrorBodyTooLarge and the 413 replaces the handler's response
+	// if that has not started yet.
+	MaxRequestLineBytes int
+	MaxHeaderBytes      int
+	MaxHeaderCount      int
+	MaxBodyBytes        int
+
+	// MaxPipelinedRequests caps how many requests in a row a client may send
+	// without waiting for the previous response. Requests are always
+	// answered one at a time, in order; the response that reaches the cap
+	// closes the connection and the client has to resend the rest. Zero
+	// selects defaultMaxPipelinedRequests.
+	MaxPipelinedRequests int
+
+	// ExpectContinue, if set, vets requests sent with "Expect: 100-continue"
+	// before the client transmits the body. Returning StatusContinue, or
+	// zero, lets the request through; the 100 Continue is then sent when the
+	// handler first reads the body. Any other status, typically 417
+	// Expectation Failed or 413 Content Too Large, is sent as the final
+	// response instead and the handler does not run.
+	ExpectContinue func(*request.Request) response.StatusCode
+
+	// ErrorLog receives errors from accepting connections, unparseable
+	// requests and recovered panics. When nil, the log package's standard
+	// logger is used.
+	ErrorLog *log.Logger
+	// ConnState, if set, is called whenever a connection changes state.
+	ConnState func(net.Conn, ConnState)
+}
+
+// statusForParseError picks the response status for a request that could
+// not be parsed.
+func statusForParseError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, request.ErrorRequestLineTooLong):
+		return response.StatusURITooLong
+	case errors.Is(err, request.ErrorHeadersTooLarge):
+		return response.StatusHeaderFieldsTooLarge
+	case errors.Is(err, request.ErrorBodyTooLarge):
+		return response.StatusContentTooLarge
+	case errors.Is(err, request.ErrorUnsupportedHttpVersion):
+		return response.StatusHTTPVersionNotSupported
+	case errors.Is(err, request.ErrorUnsupportedTransferEncoding):
+		return response.StatusNotImplemented
+	default:
+		return response.StatusBadRequest
+	}
+}
 
 // Server represents our HTTP server.
 type Server struct {
-	closed  bool
-	handler Handler
+	closed  atomic.Bool
+	handler response.Handler
+	config  Config
+
+	// mu guards listeners and conns, the open connections and their current
+	// state.
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]connStatus
 }
 
-// runConnection is responsible for handling a single TCP connection.
-func runConnection(s *Server, conn io.ReadWriteCloser) {
-	// Ensure the connection is closed when this function exits.
-	defer conn.Close()
+// connStatus is the tracked state of a connection and when it entered it.
+type connStatus struct {
+	state ConnState
+	since time.Time
+}
+
+// New returns a server that answers requests with handler. It does nothing
+// until Serve is called.
+func New(handler response.Handler, config Config) *Server {
+	return &Server{handler: handler, config: config}
+}
 
-	// Create a response writer that writes back to the connection.
-	responseWriter := response.NewWriter(conn)
-
-	// Use the request parser to read from the connection and build a request object.
-	r, err := request.RequestFromReader(conn)
-	if err != nil {
-		// If parsing fails, send a 400 Bad Request response.
-		// A more robust server might log this error.
-		log.Printf("Failed to parse request: %v", err)
-		responseWriter.WriteStatusLine(response.StatusBadRequest)
-		responseWriter.WriteHeaders(*response.GetDefaultHeaders(0))
+// logf writes to the configured error log.
+func (s *Server) logf(format string, args ...any) {
+	if s.config.ErrorLog != nil {
+		s.config.ErrorLog.Printf(format, args...)
 		return
 	}
+	log.Printf(format, args...)
+}
+
+// setConnState records the state of a connection so Shutdown knows which ones
+// it may close right away, and reports it to the ConnState hook.
+func (s *Server) setConnState(conn net.Conn, state ConnState) {
+	s.mu.Lock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]connStatus)
+	}
+	changed := s.conns[conn].state != state
+	if _, ok := s.conns[conn]; !ok || changed {
+		s.conns[conn] = connStatus{state: state, since: time.Now()}
+	}
+	s.mu.Unlock()
 
-	// The request was parsed successfully. Call the main handler to generate a response.
-	s.handler(responseWriter, r)
+	if hook := s.config.ConnState; hook != nil && (changed || state == StateNew) {
+		hook(conn, state)
+	}
 }
 
-// runServer is the main loop that accepts incoming TCP connections.
-func runServer(s *Server, listener net.Listener) {
-	// Loop indefinitely, waiting for new connections.
-	for {
-		// Block until a new connection is received.
-		conn, err := listener.Accept()
+// forgetConn stops tracking a connection once it has been closed.
+func (s *Server) forgetConn(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	if hook := s.config.ConnState; hook != nil {
+		hook(conn, StateClosed)
+	}
+}
+
+// closeIdleConns closes every connection that is not serving a request and
+// reports whether no connections are left at all. New connections count as
+// idle only once they have had newConnGracePeriod to send their first
+// request.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, status := range s.conns {
+		if status.state == StateIdle ||
+			status.state == StateNew && time.Since(status.since) >= newConnGracePeriod {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+// closeAllConns closes every tracked connection, in flight or not.
+func (s *Server) closeAllConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+// deadline returns the absolute deadline for a timeout, or the zero time
+// (no deadline) when the timeout is disabled.
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// continueReader wraps the body of a request that expects a 100 Continue.
+// The interim response goes out on the first read, so a client is only asked
+// for the body if the handler actually wants it. Until then the response is
+// set to close the connection, because a body that was never asked for may
+// never arrive.
+type continueReader struct {
+	body      io.ReadCloser
+	w         *response.Writer
+	keepAlive bool
+	started   bool
+}
+
+func (c *continueReader) Read(p []byte) (int, error) {
+	if !c.started {
+		c.started = true
+		// Once the final response is on the wire a 100 Continue would be out
+		// of place, and the connection has already been declared closing.
+		if c.w.WriteInformational(response.StatusContinue, nil) == nil {
+			c.w.SetKeepAlive(c.keepAlive)
+		}
+	}
+	return c.body.Read(p)
+}
+
+// Close leaves the body alone if the client was never asked for it, since it
+// may never arrive. The connection cannot be reused in that case.
+func (c *continueReader) Close() error {
+	if !c.started {
+		return nil
+	}
+	return c.body.Close()
+}
+
+// limitedBody watches for a chunked body that runs past MaxBodyBytes, which
+// the parser only notices as the handler reads it. Unless the response has
+// already started, the client then gets a 413 straight away and whatever the
+// handler writes afterwards is discarded. Either way the rest of the body is
+// never read, so the response is the last on the connection.
+type limitedBody struct {
+	io.ReadCloser
+	w *response.Writer
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, request.ErrorBodyTooLarge) {
+		b.w.SetKeepAlive(false)
+		if b.w.Reset() {
+			b.w.WriteStatusLine(response.StatusContentTooLarge)
+			b.w.WriteHeaders(*response.GetDefaultHeaders(0))
+			b.w.Finish()
+		}
+	}
+	return n, err
+}
+
+// checkExpect answers requests whose Expect header the server will not
+// honour and reports whether the handler may run. An expectation other
+// than 100-continue fails with 417; a 100-continue request may be turned
+// down by the ExpectContinue hook.
+func (s *Server) checkExpect(w *response.Writer, r *request.Request) bool {
+	status := response.StatusContinue
+	if r.ExpectsContinue() {
+		if s.config.ExpectContinue != nil {
+			status = s.config.ExpectContinue(r)
+		}
+	} else if _, ok := r.Headers.Get("expect"); ok && r.RequestLine.ProtoAtLeast(1, 1) {
+		status = response.StatusExpectationFailed
+	}
+	if status == 0 || status == response.StatusContinue {
+		return true
+	}
+	// The client may still send the body after giving up on waiting, so
+	// the connection cannot be trusted for another request.
+	w.SetKeepAlive(false)
+	w.WriteStatusLine(status)
+	w.WriteHeaders(*response.GetDefaultHeaders(0))
+	return false
+}
+
+// runHandler calls the handler, containing any panic it raises so that one
+// bad request cannot crash the server. It reports false after a panic; the
+// client then gets a 500 if the response had not started, and the connection
+// must be closed either way.
+func runHandler(s *Server, w *response.Writer, r *request.Request) (ok bool) {
+	defer func() {
+		err := recover()
+		if err == nil {
+			return
+		}
+		s.logf("panic serving %s %s: %v\n%s", r.RequestLine.Method, r.RequestLine.RequestTarget, err, debug.Stack())
+		ok = false
+		if w.Reset() {
+			w.SetKeepAlive(false)
+			w.WriteStatusLine(response.StatusInternalServerError)
+			w.WriteHeaders(*response.GetDefaultHeaders(0))
+			w.Finish()
+		}
+	}()
+	s.handler.ServeHTTP(w, r)
+	return true
+}
+
+// runConnection is responsible for handling a single TCP connection. It keeps
+// serving requests on the connection until either side asks to close it.
+func runConnection(s *Server, conn net.Conn) {
+	// Ensure the connection is closed and forgotten when this function exits.
+	defer s.forgetConn(conn)
+	defer conn.Close()
+	// Anything that panics outside the handler, such as the parser, only
+	// costs this connection.
+	defer func() {
+		if err := recover(); err != nil {
+			s.logf("panic on connection from %s: %v\n%s", conn.RemoteAddr(), err, debug.Stack())
+		}
+	}()
+
+	// The buffered reader lets us wait for the first byte of a request
+	// without consuming it. The request reader on top of it keeps any bytes
+	// left over from one request for the next.
+	br := bufio.NewReader(conn)
+	requests := request.NewReader(br, request.Options{
+		MaxRequestLineBytes: s.config.MaxRequestLineBytes,
+		MaxHeaderBytes:      s.config.MaxHeaderBytes,
+		MaxHeaderCount:      s.config.MaxHeaderCount,
+		MaxBodyBytes:        s.config.MaxBodyBytes,
+	})
+
+	maxPipelined := s.config.MaxPipelinedRequests
+	if maxPipelined <= 0 {
+		maxPipelined = defaultMaxPipelinedRequests
+	}
+
+	for first, pipelined := true, 0; ; first = false {
+		// Between requests the connection is idle and may be closed by
+		// Shutdown. A new connection still gets to send its first request.
+		if !first {
+			s.setConnState(conn, StateIdle)
+			if s.closed.Load() {
+				return
+			}
+		}
+
+		// A request that had already arrived when the previous response went
+		// out was pipelined behind it.
+		if !first && requests.Buffered()+br.Buffered() > 0 {
+			pipelined++
+		} else {
+			pipelined = 0
+		}
+
+		// A fresh connection must start its request within the header timeout;
+		// a reused one may sit idle for up to the idle timeout.
+		if requests.Buffered() == 0 {
+			waitTimeout := s.config.IdleTimeout
+			if first || waitTimeout <= 0 {
+				waitTimeout = s.config.ReadHeaderTimeout
+			}
+			conn.SetReadDeadline(deadline(waitTimeout))
+			if _, err := br.Peek(1); err != nil {
+				// Either the client hung up or the connection idled out; there is
+				// no request to answer in both cases.
+				return
+			}
+		}
+		s.setConnState(conn, StateActive)
+
+		// Create a response writer that writes back to the connection.
+		responseWriter := response.NewWriter(conn)
+
+		// Use the request parser to read the request line and headers.
+		conn.SetReadDeadline(deadline(s.config.ReadHeaderTimeout))
+		r, err := requests.ReadRequest()
 		if err != nil {
-			// If the server has been closed, we can expect an error here, so we just exit.
-			if s.closed {
-				log.Println("Accept loop closed.")
+			// The client closed the connection between requests; nothing to answer.
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			responseWriter.SetKeepAlive(false)
+			conn.SetWriteDeadline(deadline(s.config.WriteTimeout))
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				// The headers did not arrive in time.
+				responseWriter.WriteStatusLine(response.StatusRequestTimeout)
+				responseWriter.WriteHeaders(*response.GetDefaultHeaders(0))
 				return
 			}
-			log.Printf("Failed to accept connection: %v", err)
+			// If parsing fails, send a 4xx response and give up on the
+			// connection, since we can no longer tell where the next request starts.
+			s.logf("Failed to parse request: %v", err)
+			responseWriter.WriteStatusLine(statusForParseError(err))
+			responseWriter.WriteHeaders(*response.GetDefaultHeaders(0))
 			return
 		}
 
-		// Handle each new connection in its own goroutine.
-		// This allows the server to handle multiple requests concurrently.
-		go runConnection(s, conn)
+		// The request was parsed successfully. Call the main handler to generate a response.
+		// The body is read by the handler under its own timeout.
+		// Once shutdown has begun, or the client has pipelined too many
+		// requests, we tell the client this is the last response.
+		conn.SetReadDeadline(deadline(s.config.ReadBodyTimeout))
+		conn.SetWriteDeadline(deadline(s.config.WriteTimeout))
+		responseWriter.SetRequestProto(r.RequestLine.Proto())
+		keepAlive := r.KeepAlive() && !s.closed.Load() && pipelined < maxPipelined
+		responseWriter.SetKeepAlive(keepAlive)
+		if r.RequestLine.Method == "HEAD" {
+			responseWriter.SuppressBody()
+		}
+		if !s.checkExpect(responseWriter, r) {
+			return
+		}
+		r.Body = &limitedBody{ReadCloser: r.Body, w: responseWriter}
+		if r.ExpectsContinue() {
+			r.Body = &continueReader{body: r.Body, w: responseWriter, keepAlive: keepAlive}
+			responseWriter.SetKeepAlive(false)
+		}
+		if !runHandler(s, responseWriter, r) {
+			return
+		}
+		if err := responseWriter.Finish(); err != nil {
+			return
+		}
+
+		// Discard any body the handler did not read so the next request starts
+		// in the right place. If that is not possible, the connection is done.
+		if err := r.Body.Close(); err != nil {
+			return
+		}
+
+		// Only go around again if the response left the connection reusable.
+		if !responseWriter.KeepAlive() {
+			return
+		}
 	}
 }
 
-// Serve is the entry point for starting the server. It sets up the TCP listener
-// and starts the main accept loop in a new goroutine.
-func Serve(port uint16, handler Handler) (*Server, error) {
-	// Start listening for TCP connections on the given port.
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return nil, err
+// trackListener adds or removes a listener from the set Close and Shutdown
+// stop. It reports false if the server is already closed.
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.closed.Load() {
+		return false
 	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// closeListeners closes every listener the server is accepting on.
+func (s *Server) closeListeners() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.listeners, l)
+	}
+	return err
+}
 
-	server := &Server{closed: false, handler: handler}
+// Serve accepts connections on l and serves each in its own goroutine. It
+// blocks until the listener fails or the server is closed; in the latter
+// case it returns ErrorServerClosed. Temporary accept errors are logged and
+// retried after a growing pause. Serve closes l on return and may be called
+// for several listeners at once.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l, true) {
+		l.Close()
+		return ErrorServerClosed
+	}
+	defer s.trackListener(l, false)
+	defer l.Close()
 
-	// Start the main server loop in a separate goroutine so that Serve can return immediately.
-	go runServer(server, listener)
+	// Loop indefinitely, waiting for new connections.
+	var backoff time.Duration
+	for {
+		// Block until a new connection is received.
+		conn, err := l.Accept()
+		if err != nil {
+			// If the server has been closed, we can expect an error here.
+			if s.closed.Load() {
+				return ErrorServerClosed
+			}
+			// Running out of file descriptors and the like passes once
+			// connections close, so wait a little and try again.
+			var temp interface{ Temporary() bool }
+			if errors.As(err, &temp) && temp.Temporary() {
+				backoff = min(max(2*backoff, minAcceptBackoff), maxAcceptBackoff)
+				s.logf("Failed to accept connection: %v; retrying in %v", err, backoff)
+				time.Sleep(backoff)
+				continue
+			}
+			s.logf("Failed to accept connection: %v", err)
+			return err
+		}
+		backoff = 0
 
-	return server, nil
+		// Handle each new connection in its own goroutine.
+		// This allows the server to handle multiple requests concurrently.
+		s.setConnState(conn, StateNew)
+		go runConnection(s, conn)
+	}
 }
 
-// Close signals the server to stop accepting new connections.
+// Close immediately stops the server: the listener is closed and every open
+// connection is dropped, including those with requests in flight.
 func (s *Server) Close() error {
-	s.closed = true
-	return nil
+	s.closed.Store(true)
+	err := s.closeListeners()
+	s.closeAllConns()
+	return err
+}
+
+// Shutdown gracefully stops the server. It closes the listener so no new
+// connections are accepted, closes idle connections, and then waits for the
+// requests in flight to finish. Connections accepted but not yet sending a
+// request are given newConnGracePeriod to do so. If ctx expires first, the remaining
+// connections are closed forcibly and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closed.Store(true)
+	err := s.closeListeners()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.closeAllConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
 }
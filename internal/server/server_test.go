@@ -0,0 +1,670 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func helloHandler(w *response.Writer, r *request.Request) {
+	body := []byte("hello " + r.RequestLine.RequestTarget)
+	w.WriteStatusLine(response.StatusOk)
+	w.WriteHeaders(*response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// startConnection runs handler on one end of an in-memory connection and
+// returns the client end.
+func startConnection(t *testing.T, handler response.HandlerFunc, config Config) (net.Conn, <-chan struct{}) {
+	t.Helper()
+	client, srv := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		runConnection(&Server{handler: handler, config: config}, srv)
+		close(done)
+	}()
+	t.Cleanup(func() { client.Close() })
+	return client, done
+}
+
+// startServer serves handler on a local port and returns the server and the
+// address it listens on. Serve's result is checked once the test is over.
+func startServer(t *testing.T, handler response.HandlerFunc, config Config) (*Server, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := New(handler, config)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		assert.ErrorIs(t, <-served, ErrorServerClosed)
+	})
+	return s, l.Addr().String()
+}
+
+func TestKeepAlive(t *testing.T) {
+	// Test: Two requests on the same connection
+	client, done := startConnection(t, helloHandler, Config{})
+	br := bufio.NewReader(client)
+
+	for _, path := range []string{"/one", "/two"} {
+		_, err := io.WriteString(client, "GET "+path+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(t, err)
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "hello "+path, string(body))
+		assert.False(t, res.Close)
+	}
+
+	// Test: A stray CRLF after a request body does not break the next request
+	_, err := io.WriteString(client, "POST /body HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\n\r\nhi\r\n")
+	require.NoError(t, err)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	io.ReadAll(res.Body)
+	assert.Equal(t, 200, res.StatusCode)
+	_, err = io.WriteString(client, "GET /after HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "hello /after", string(body))
+
+	// Test: Client asks to close
+	_, err = io.WriteString(client, "GET /three HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	io.ReadAll(res.Body)
+	assert.True(t, res.Close)
+	<-done
+}
+
+func TestResponseFraming(t *testing.T) {
+	// Test: A response without Content-Length is framed by the writer and
+	// the connection stays open
+	client, done := startConnection(t, func(w *response.Writer, r *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Delete("content-length")
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(*h)
+		w.WriteBody([]byte("streamed"))
+	}, Config{})
+	br := bufio.NewReader(client)
+
+	for i := 0; i < 2; i++ {
+		_, err := io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(t, err)
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "streamed", string(body))
+		assert.Equal(t, int64(8), res.ContentLength)
+		assert.False(t, res.Close)
+	}
+
+	// Test: A handler that writes nothing still answers
+	client, done = startConnection(t, func(w *response.Writer, r *request.Request) {}, Config{})
+	go io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	res, err := http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	<-done
+}
+
+func TestShutdownDrainsConnections(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	s, addr := startServer(t, func(w *response.Writer, r *request.Request) {
+		close(entered)
+		<-release
+		helloHandler(w, r)
+	}, Config{})
+
+	client, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = io.WriteString(client, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-entered
+
+	// Test: Shutdown waits for the in-flight request
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before the request finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Test: New connections are refused once shutdown has begun
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+
+	close(release)
+	br := bufio.NewReader(client)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello /slow", string(body))
+	require.NoError(t, <-shutdownErr)
+
+	// Test: The drained connection is closed rather than kept alive
+	_, err = br.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestShutdownWaitsForFirstRequest(t *testing.T) {
+	accepted := make(chan struct{})
+	s, addr := startServer(t, helloHandler, Config{
+		ConnState: func(_ net.Conn, state ConnState) {
+			if state == StateNew {
+				close(accepted)
+			}
+		},
+	})
+
+	client, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer client.Close()
+	<-accepted
+
+	// Test: A connection accepted before Shutdown still gets its first request answered
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	_, err = io.WriteString(client, "GET /late HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	br := bufio.NewReader(client)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello /late", string(body))
+	assert.True(t, res.Close)
+	require.NoError(t, <-shutdownErr)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	entered := make(chan struct{})
+	block := make(chan struct{})
+	defer close(block)
+	s, addr := startServer(t, func(w *response.Writer, r *request.Request) {
+		close(entered)
+		<-block
+	}, Config{})
+
+	client, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = io.WriteString(client, "GET /stuck HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-entered
+
+	// Test: Connections still busy at the deadline are closed forcibly
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = s.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = client.Read(make([]byte, 1))
+	require.Error(t, err)
+}
+
+func TestTimeouts(t *testing.T) {
+	config := Config{
+		ReadHeaderTimeout: 50 * time.Millisecond,
+		IdleTimeout:       50 * time.Millisecond,
+	}
+
+	// Test: Headers that never finish get a 408
+	client, done := startConnection(t, helloHandler, config)
+	_, err := io.WriteString(client, "GET / HTTP/1.1\r\nHost: local")
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 408, res.StatusCode)
+	assert.True(t, res.Close)
+	<-done
+
+	// Test: A kept-alive connection is closed once it idles out
+	client, done = startConnection(t, helloHandler, config)
+	br := bufio.NewReader(client)
+	_, err = io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	io.ReadAll(res.Body)
+	assert.Equal(t, 200, res.StatusCode)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection was not closed")
+	}
+	_, err = br.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: A connection that never sends anything is dropped silently
+	client, done = startConnection(t, helloHandler, config)
+	<-done
+	_, err = client.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestRequestLimits(t *testing.T) {
+	config := Config{MaxRequestLineBytes: 64, MaxHeaderCount: 2, MaxBodyBytes: 4}
+	cases := []struct {
+		name   string
+		req    string
+		status int
+	}{
+		{"request line", "GET /" + strings.Repeat("a", 100) + " HTTP/1.1\r\nHost: localhost\r\n\r\n", 414},
+		{"header count", "GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n", 431},
+		{"body", "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello", 413},
+	}
+	for _, c := range cases {
+		// Test: Each limit maps to its own status code
+		client, done := startConnection(t, helloHandler, config)
+		go io.WriteString(client, c.req)
+		res, err := http.ReadResponse(bufio.NewReader(client), nil)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.status, res.StatusCode, c.name)
+		assert.True(t, res.Close, c.name)
+		<-done
+	}
+}
+
+func TestChunkedBodyTooLarge(t *testing.T) {
+	// Test: A chunked body over MaxBodyBytes gets a 413, whatever the handler answered
+	client, done := startConnection(t, func(w *response.Writer, r *request.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			response.Respond400(w)
+			return
+		}
+		helloHandler(w, r)
+	}, Config{MaxBodyBytes: 4})
+	go io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"5\r\nhello\r\n0\r\n\r\nGET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	br := bufio.NewReader(client)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	io.ReadAll(res.Body)
+	assert.Equal(t, 413, res.StatusCode)
+
+	// Test: The connection is announced as closing and then closed
+	assert.True(t, res.Close)
+	<-done
+	_, err = br.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestSmuggling(t *testing.T) {
+	cases := []struct {
+		name   string
+		req    string
+		status int
+	}{
+		{"content-length list", "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0,44\r\n\r\nGET /admin HTTP/1.1\r\nHost: localhost\r\n\r\n", 400},
+		{"te and cl", "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", 400},
+		{"folded header", "GET / HTTP/1.1\r\nHost: localhost\r\n Transfer-Encoding: chunked\r\n\r\n", 400},
+		{"missing host", "GET /admin HTTP/1.1\r\n\r\n", 400},
+		{"unknown coding", "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: gzip\r\n\r\n", 501},
+	}
+	for _, c := range cases {
+		// Test: Ambiguous framing is refused and the connection closed, so
+		// nothing after it is taken as a second request
+		var served []string
+		handler := func(w *response.Writer, r *request.Request) {
+			served = append(served, r.RequestLine.RequestTarget)
+		}
+		client, done := startConnection(t, handler, Config{})
+		go io.WriteString(client, c.req)
+		br := bufio.NewReader(client)
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.status, res.StatusCode, c.name)
+		assert.True(t, res.Close, c.name)
+		<-done
+		assert.Empty(t, served, c.name)
+	}
+}
+
+func TestUnreadBodyIsDrained(t *testing.T) {
+	// Test: The handler ignores the body; the next request still parses
+	client, done := startConnection(t, helloHandler, Config{})
+	br := bufio.NewReader(client)
+	go io.WriteString(client, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\nhello world"+
+		"GET /next HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+
+	for _, path := range []string{"/upload", "/next"} {
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "hello "+path, string(body))
+	}
+	<-done
+}
+
+func TestHeadResponse(t *testing.T) {
+	// Test: HEAD gets the headers of GET, no body, and the connection lives on
+	client, done := startConnection(t, helloHandler, Config{})
+	br := bufio.NewReader(client)
+	go io.WriteString(client, "HEAD /page HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /page HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+
+	res, err := http.ReadResponse(br, &http.Request{Method: "HEAD"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("hello /page")), res.ContentLength)
+
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello /page", string(body))
+	<-done
+}
+
+func TestHandlerPanic(t *testing.T) {
+	// Test: A panic before the response started becomes a 500 and the
+	// connection is closed
+	client, done := startConnection(t, func(w *response.Writer, r *request.Request) {
+		w.Header().Set("X-Half-Done", "yes")
+		panic("boom")
+	}, Config{})
+	br := bufio.NewReader(client)
+	go io.WriteString(client, "GET /boom HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Empty(t, res.Header.Get("X-Half-Done"))
+	assert.True(t, res.Close)
+	<-done
+
+	// Test: A panic after the response started cuts it short
+	client, done = startConnection(t, func(w *response.Writer, r *request.Request) {
+		w.WriteBody([]byte("partial"))
+		w.Flush()
+		panic("boom")
+	}, Config{})
+	br = bufio.NewReader(client)
+	go io.WriteString(client, "GET /boom HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	_, err = io.ReadAll(res.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	<-done
+}
+
+func TestConnStateHook(t *testing.T) {
+	states := make(chan ConnState, 10)
+	_, addr := startServer(t, helloHandler, Config{
+		ConnState: func(c net.Conn, state ConnState) { states <- state },
+	})
+
+	// Test: A connection goes new, active, idle, active, closed
+	client, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	br := bufio.NewReader(client)
+	for _, last := range []bool{false, true} {
+		req := "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"
+		if last {
+			req = "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"
+		}
+		_, err = io.WriteString(client, req)
+		require.NoError(t, err)
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		io.ReadAll(res.Body)
+	}
+	client.Close()
+
+	var got []ConnState
+	for len(got) < 5 {
+		select {
+		case state := <-states:
+			got = append(got, state)
+		case <-time.After(time.Second):
+			t.Fatalf("missing state changes, got %v", got)
+		}
+	}
+	assert.Equal(t, []ConnState{StateNew, StateActive, StateIdle, StateActive, StateClosed}, got)
+}
+
+func TestServeAfterClose(t *testing.T) {
+	// Test: A closed server refuses new listeners and closes them
+	s := New(response.HandlerFunc(helloHandler), Config{})
+	require.NoError(t, s.Close())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.Serve(l), ErrorServerClosed)
+	_, err = l.Accept()
+	assert.Error(t, err)
+}
+
+// flakyListener fails its first Accept calls with errs before handing over
+// to the wrapped listener, and records whether it was closed.
+type flakyListener struct {
+	net.Listener
+	errs   []error
+	closed bool
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+		return nil, err
+	}
+	return l.Listener.Accept()
+}
+
+func (l *flakyListener) Close() error {
+	l.closed = true
+	return l.Listener.Close()
+}
+
+func TestAcceptErrors(t *testing.T) {
+	// Test: Temporary accept errors, like running out of file descriptors, are retried
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	emfile := &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+	l := &flakyListener{Listener: inner, errs: []error{emfile, emfile}}
+	s := New(response.HandlerFunc(helloHandler), Config{ErrorLog: log.New(io.Discard, "", 0)})
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	res, err := http.Get("http://" + inner.Addr().String() + "/up")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, s.Close())
+	assert.ErrorIs(t, <-served, ErrorServerClosed)
+
+	// Test: Other accept errors stop Serve, which still closes the listener
+	inner, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	fatal := errors.New("listener broken")
+	l = &flakyListener{Listener: inner, errs: []error{fatal}}
+	s = New(response.HandlerFunc(helloHandler), Config{ErrorLog: log.New(io.Discard, "", 0)})
+	assert.ErrorIs(t, s.Serve(l), fatal)
+	assert.True(t, l.closed)
+}
+
+func TestHTTP10(t *testing.T) {
+	// Test: HTTP/1.0 closes after the response by default
+	client, done := startConnection(t, helloHandler, Config{})
+	go io.WriteString(client, "GET /old HTTP/1.0\r\n\r\n")
+	res, err := http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello /old", string(body))
+	assert.True(t, res.Close)
+	<-done
+
+	// Test: Keep-alive is honoured when asked for
+	client, done = startConnection(t, helloHandler, Config{})
+	br := bufio.NewReader(client)
+	go io.WriteString(client, "GET /one HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"+
+		"GET /two HTTP/1.0\r\n\r\n")
+	for _, path := range []string{"/one", "/two"} {
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "hello "+path, string(body))
+	}
+	<-done
+
+	// Test: Unknown major versions get a 505
+	client, done = startConnection(t, helloHandler, Config{})
+	go io.WriteString(client, "GET / HTTP/2.0\r\n\r\n")
+	res, err = http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 505, res.StatusCode)
+	<-done
+}
+
+func TestPipelining(t *testing.T) {
+	// Test: Requests sent back to back are answered in order
+	client, done := startConnection(t, helloHandler, Config{})
+	br := bufio.NewReader(client)
+	go io.WriteString(client, "GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"POST /two HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello"+
+		"GET /three HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	for _, path := range []string{"/one", "/two", "/three"} {
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "hello "+path, string(body))
+	}
+	<-done
+
+	// Test: The response that reaches the cap closes the connection
+	client, done = startConnection(t, helloHandler, Config{MaxPipelinedRequests: 2})
+	br = bufio.NewReader(client)
+	go io.WriteString(client, strings.Repeat("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", 4))
+	for i := 0; i < 3; i++ {
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		io.ReadAll(res.Body)
+		assert.Equal(t, i == 2, res.Close)
+	}
+	<-done
+	_, err := http.ReadResponse(br, nil)
+	assert.Error(t, err)
+
+	// Test: Waiting for a response resets the count
+	client, _ = startConnection(t, helloHandler, Config{MaxPipelinedRequests: 1})
+	br = bufio.NewReader(client)
+	for i := 0; i < 3; i++ {
+		_, err := io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(t, err)
+		res, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		io.ReadAll(res.Body)
+		assert.False(t, res.Close)
+	}
+}
+
+func echoHandler(w *response.Writer, r *request.Request) {
+	body, err := r.ReadBody()
+	if err != nil {
+		w.WriteStatusLine(response.StatusBadRequest)
+		return
+	}
+	w.WriteBody(body)
+}
+
+func TestExpectContinue(t *testing.T) {
+	tooLarge := func(r *request.Request) response.StatusCode {
+		if length, _ := r.Headers.Get("content-length"); len(length) > 2 {
+			return response.StatusContentTooLarge
+		}
+		return response.StatusContinue
+	}
+
+	// Test: 100 Continue is sent when the handler reads the body
+	client, _ := startConnection(t, echoHandler, Config{ExpectContinue: tooLarge})
+	br := bufio.NewReader(client)
+	_, err := io.WriteString(client, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 100, res.StatusCode)
+	_, err = io.WriteString(client, "hello")
+	require.NoError(t, err)
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.False(t, res.Close)
+
+	// Test: The hook can turn the body down before it is sent
+	_, err = io.WriteString(client, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 500\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	res, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 413, res.StatusCode)
+	assert.True(t, res.Close)
+
+	// Test: A handler that ignores the body never asks for it
+	client, done := startConnection(t, helloHandler, Config{})
+	_, err = io.WriteString(client, "POST /skip HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	res, err = http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	io.ReadAll(res.Body)
+	assert.True(t, res.Close)
+	<-done
+
+	// Test: Unknown expectations fail with 417
+	client, done = startConnection(t, echoHandler, Config{})
+	go io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\nExpect: teapot\r\n\r\n")
+	res, err = http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 417, res.StatusCode)
+	<-done
+
+	// Test: HTTP/1.0 clients get no interim response
+	client, done = startConnection(t, echoHandler, Config{})
+	go io.WriteString(client, "POST / HTTP/1.0\r\nContent-Length: 2\r\nExpect: 100-continue\r\n\r\nhi")
+	res, err = http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(body))
+	<-done
+}
@@ -0,0 +1,159 @@
+package httpfromtcp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// unixAddrPrefix marks a Server.Addr that names a Unix domain socket.
+const unixAddrPrefix = "unix:"
+
+// listenFdsStart is the first file descriptor passed by systemd socket
+// activation.
+var listenFdsStart = 3
+
+var ErrorSocketInUse = fmt.Errorf("unix socket is in use by another process")
+var ErrorNotASocket = fmt.Errorf("path exists and is not a unix socket")
+var ErrorNoListeners = fmt.Errorf("no listeners to serve on")
+
+// UnixSocketOptions controls the socket file ListenUnix creates. Zero values
+// leave the defaults from the process's umask and identity in place.
+type UnixSocketOptions struct {
+	// Mode sets the socket file's permission bits, e.g. 0o660 to let a
+	// sidecar in the same group connect.
+	Mode os.FileMode
+	// Owner and Group name the user and group that own the socket file, by
+	// name or numeric ID.
+	Owner string
+	Group string
+}
+
+// ListenUnix listens on a Unix domain socket at path. A socket file left
+// behind by a process that is gone is removed first; one that still accepts
+// connections, or any other kind of file, is left alone and reported as an
+// error. The socket file is removed when the listener is closed.
+func ListenUnix(path string, opts UnixSocketOptions) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySocketOptions(path, opts); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// removeStaleSocket deletes the socket file at path if nothing is listening
+// on it anymore.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%w: %s", ErrorNotASocket, path)
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s", ErrorSocketInUse, path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// applySocketOptions sets the mode and ownership of a new socket file.
+func applySocketOptions(path string, opts UnixSocketOptions) error {
+	if opts.Mode != 0 {
+		if err := os.Chmod(path, opts.Mode); err != nil {
+			return err
+		}
+	}
+	if opts.Owner == "" && opts.Group == "" {
+		return nil
+	}
+	uid, gid := -1, -1
+	if opts.Owner != "" {
+		id, err := lookupID(opts.Owner, user.Lookup, func(u *user.User) string { return u.Uid })
+		if err != nil {
+			return err
+		}
+		uid = id
+	}
+	if opts.Group != "" {
+		id, err := lookupID(opts.Group, user.LookupGroup, func(g *user.Group) string { return g.Gid })
+		if err != nil {
+			return err
+		}
+		gid = id
+	}
+	return os.Chown(path, uid, gid)
+}
+
+// lookupID resolves a user or group given by name or numeric ID.
+func lookupID[T any](name string, lookup func(string) (*T, error), id func(*T) string) (int, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		return n, nil
+	}
+	found, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id(found))
+}
+
+// SystemdListeners returns the sockets passed to the process by systemd
+// socket activation (LISTEN_PID, LISTEN_FDS), in order. It returns no
+// listeners and no error when the process was not socket-activated. The
+// environment variables are cleared so child processes do not inherit them.
+func SystemdListeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("LISTEN_FD_%d", listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		// FileListener works on a duplicate, so the original is closed
+		// either way.
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket activation fd %s: %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,136 @@
+//go:build unix
+
+package httpfromtcp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var helloListener = HandlerFunc(func(w *response.Writer, r *request.Request) {
+	w.WriteBody([]byte("hello"))
+})
+
+// get makes a request over conn and returns the response body.
+func get(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	defer conn.Close()
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.sock")
+
+	// Test: Serving on a unix: address, with the requested mode and owner
+	s := &Server{
+		Addr:       "unix:" + path,
+		Handler:    helloListener,
+		UnixSocket: UnixSocketOptions{Mode: 0o660, Owner: strconv.Itoa(os.Getuid()), Group: strconv.Itoa(os.Getgid())},
+	}
+	_, err := s.Start()
+	require.NoError(t, err)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), fi.Mode().Perm())
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", get(t, conn))
+
+	// Test: A live socket is not taken over
+	_, err = ListenUnix(path, UnixSocketOptions{})
+	assert.ErrorIs(t, err, ErrorSocketInUse)
+
+	// Test: Closing the server removes the socket file
+	require.NoError(t, s.Shutdown(context.Background()))
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Test: A stale socket left by a dead process is replaced
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = ListenUnix(path, UnixSocketOptions{})
+	require.NoError(t, err)
+	l.Close()
+
+	// Test: Other files are never removed
+	other := filepath.Join(dir, "data.txt")
+	require.NoError(t, os.WriteFile(other, []byte("keep"), 0o600))
+	_, err = ListenUnix(other, UnixSocketOptions{})
+	assert.ErrorIs(t, err, ErrorNotASocket)
+	_, err = os.Stat(other)
+	assert.NoError(t, err)
+}
+
+func TestSystemdListeners(t *testing.T) {
+	// Test: Not socket-activated
+	t.Setenv("LISTEN_PID", "")
+	listeners, err := SystemdListeners()
+	require.NoError(t, err)
+	assert.Empty(t, listeners)
+
+	// Test: Activated for another process
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	listeners, err = SystemdListeners()
+	require.NoError(t, err)
+	assert.Empty(t, listeners)
+
+	// Test: The passed sockets are served, and the variables cleared. The
+	// test hands over a socket at whatever descriptor it got rather than 3.
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f, err := tcp.(*net.TCPListener).File()
+	require.NoError(t, err)
+	// SystemdListeners takes ownership of the descriptor, so hand it one
+	// that no *os.File will close again.
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.NoError(t, err)
+	f.Close()
+	tcp.Close()
+	defer func(start int) { listenFdsStart = start }(listenFdsStart)
+	listenFdsStart = fd
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "web")
+	listeners, err = SystemdListeners()
+	require.NoError(t, err)
+	require.Len(t, listeners, 1)
+	_, set := os.LookupEnv("LISTEN_FDS")
+	assert.False(t, set)
+
+	s := &Server{Handler: helloListener}
+	served := make(chan error, 1)
+	go func() { served <- s.ServeListeners(listeners) }()
+	conn, err := net.Dial("tcp", listeners[0].Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, "hello", get(t, conn))
+	require.NoError(t, s.Close())
+	assert.ErrorIs(t, <-served, ErrorServerClosed)
+
+	// Test: Nothing to serve on
+	assert.ErrorIs(t, (&Server{}).ServeListeners(nil), ErrorNoListeners)
+}
@@ -0,0 +1,110 @@
+package mux
+
+import (
+	"slices"
+	"strings"
+
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+)
+
+// anyMethod is the method key under which mounted handlers are stored. It
+// matches requests of every method.
+const anyMethod = "*"
+
+// mountParam is the name of the catch-all parameter a mount point captures
+// the rest of the path in. The mount removes it before calling the handler.
+const mountParam = "*"
+
+// RouteOption configures a single route registered with HandleFunc.
+type RouteOption func(*routeConfig)
+
+type routeConfig struct {
+	middlewares []Middleware
+}
+
+// WithMiddleware wraps a single route's handler in the given middleware.
+// It runs after any middleware of the group the route belongs to.
+func WithMiddleware(mws ...Middleware) RouteOption {
+	return func(c *routeConfig) {
+		c.middlewares = append(c.middlewares, mws...)
+	}
+}
+
+// Group registers routes that share a path prefix and a set of middleware,
+// e.g. everything under "/admin" behind an authentication check.
+type Group struct {
+	mux    *Mux
+	prefix string
+	mws    []Middleware
+}
+
+// Group returns a group whose routes live under prefix and run through mws.
+func (m *Mux) Group(prefix string, mws ...Middleware) *Group {
+	return &Group{mux: m, prefix: joinPath(prefix, ""), mws: mws}
+}
+
+// Group returns a nested group. Its prefix is appended to g's, and its
+// middleware runs after g's.
+func (g *Group) Group(prefix string, mws ...Middleware) *Group {
+	return &Group{
+		mux:    g.mux,
+		prefix: joinPath(g.prefix, prefix),
+		mws:    append(slices.Clone(g.mws), mws...),
+	}
+}
+
+// Handle registers a route under the group's prefix. It behaves like
+// Mux.Handle, with the group's middleware wrapped around the handler.
+func (g *Group) Handle(method, path string, handler response.Handler, opts ...RouteOption) {
+	g.mux.handle(method, joinPath(g.prefix, path), handler, g.mws, opts)
+}
+
+// HandleFunc registers a handler function under the group's prefix.
+func (g *Group) HandleFunc(method, path string, handler HandlerFunc, opts ...RouteOption) {
+	g.mux.handle(method, joinPath(g.prefix, path), handler, g.mws, opts)
+}
+
+// Mount hands every request under the group's prefix plus prefix to handler.
+// See Mux.Mount.
+func (g *Group) Mount(prefix string, handler response.Handler) {
+	g.mux.mount(joinPath(g.prefix, prefix), handler, g.mws)
+}
+
+// Mount hands every request whose path starts with prefix, whatever its
+// method, to handler, typically another Mux. The handler sees the path with
+// the prefix removed, so a sub-router mounted at "/v1" registers "/users"
+// rather than "/v1/users". Routes registered directly on m still take
+// priority for the methods they handle; requests with any other method fall
+// through to the mount.
+func (m *Mux) Mount(prefix string, handler response.Handler) {
+	m.mount(prefix, handler, nil)
+}
+
+func (m *Mux) mount(prefix string, handler response.Handler, mws []Middleware) {
+	stripped := HandlerFunc(func(w *response.Writer, r *request.Request) {
+		rest := r.PathParams[mountParam]
+		delete(r.PathParams, mountParam)
+
+		// Restore the full path afterwards for middleware that logs it.
+		target := r.RequestLine.RequestTarget
+		r.RequestLine.RequestTarget = "/" + rest
+		defer func() { r.RequestLine.RequestTarget = target }()
+		handler.ServeHTTP(w, r)
+	})
+	m.handle(anyMethod, joinPath(prefix, "{"+mountParam+"...}"), stripped, mws, nil)
+}
+
+// joinPath joins two pattern fragments with exactly one slash between them,
+// e.g. "/admin/" and "/users" become "/admin/users".
+func joinPath(prefix, path string) string {
+	prefix = strings.Trim(prefix, "/")
+	path = strings.Trim(path, "/")
+	switch {
+	case prefix == "":
+		return "/" + path
+	case path == "":
+		return "/" + prefix
+	}
+	return "/" + prefix + "/" + path
+}
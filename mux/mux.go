@@ -0,0 +1,166 @@
+// Package mux routes requests to handlers by method and path pattern and
+// provides middleware for logging and panic recovery.
+package mux
+
+import (
+	"fmt"
+	"log"
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+// HandlerFunc lets ordinary functions be registered as handlers. It is the
+// same type as response.HandlerFunc.
+type HandlerFunc = response.HandlerFunc
+
+// Middleware is a function that takes a handler and returns a new handler.
+// This allows for chaining, where each middleware can perform some action before or after calling the next handler in the chain.
+type Middleware func(response.Handler) response.Handler
+
+// Mux is a request router (or multiplexer). It matches incoming requests
+// against a tree of registered patterns and calls the handler for the
+// pattern that matches the URL. Lookup cost depends on the length of the
+// path, not on the number of routes. A Mux is itself a response.Handler, so
+// it can be wrapped in middleware, mounted in another Mux or served directly.
+type Mux struct {
+	root *node
+}
+
+// NewMux creates and returns a new Mux.
+func NewMux() *Mux {
+	return &Mux{
+		root: newNode(),
+	}
+}
+
+// Chain wraps h in mws so that the first middleware runs first.
+func Chain(h response.Handler, mws ...Middleware) response.Handler {
+	// Start with the final handler
+	handler := h
+
+	// Loop backwards through the middlewares, wrapping the current handler with each one
+	// This ensures they execute in hte correct order
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	return handler
+
+}
+
+// LoggingMiddleware logs the details of each request
+func LoggingMiddleware(next response.Handler) response.Handler {
+	return HandlerFunc(func(w *response.Writer, r *request.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+
+		log.Printf("method=%s path=%s duration=%s", r.RequestLine.Method, r.RequestLine.RequestTarget, time.Since(start))
+	})
+}
+
+// Handle registers a new handler for the given method and path.
+// Paths may contain parameters such as "/users/{id}", parameters constrained
+// by a regular expression or one of the names int, alpha and uuid, such as
+// "/users/{id:[0-9]+}" or "/users/{id:int}", and a trailing catch-all such as
+// "/static/{path...}" that captures the rest of the path. When several
+// patterns match a request, static segments take priority over constrained
+// parameters, then plain parameters, then catch-alls. Options such as
+// WithMiddleware apply to this route only. It panics if the pattern is
+// malformed or conflicts with a route already registered.
+func (m *Mux) Handle(method, path string, handler response.Handler, opts ...RouteOption) {
+	m.handle(method, path, handler, nil, opts)
+}
+
+// HandleFunc registers a handler function for the given method and path,
+// as Handle does.
+func (m *Mux) HandleFunc(method, path string, handler HandlerFunc, opts ...RouteOption) {
+	m.handle(method, path, handler, nil, opts)
+}
+
+// handle registers a route, wrapping handler in the given group middleware
+// and then in the middleware from opts, so group middleware runs first.
+func (m *Mux) handle(method, path string, handler response.Handler, mws []Middleware, opts []RouteOption) {
+	var route routeConfig
+	for _, opt := range opts {
+		opt(&route)
+	}
+	m.root.insert(method, path, Chain(handler, append(slices.Clone(mws), route.middlewares...)...))
+}
+
+// ServeHTTP is the main entry point for routing. It finds the correct handler
+// for the request and calls it. HEAD requests fall back to the GET handler and
+// OPTIONS requests are answered automatically unless a handler is registered
+// for them. If the path matches but the method does not, it returns a 405
+// Method Not Allowed error; if nothing matches, a 404 Not Found error.
+func (m *Mux) ServeHTTP(w *response.Writer, r *request.Request) {
+	method := r.RequestLine.Method
+	var params []string
+	var handler response.Handler
+	// matched collects every node the path leads to, so a 405 can list the
+	// methods of all of them.
+	var matched []*node
+	m.root.match(splitPath(r.RequestLine.RequestTarget), &params, func(n *node) bool {
+		matched = append(matched, n)
+		h, ok := n.handler(method)
+		handler = h
+		return ok
+	})
+	if len(matched) == 0 {
+		writeError(w, response.StatusNotFound)
+		return
+	}
+	if handler == nil {
+		w.Header().Set("Allow", strings.Join(allowed(matched), ", "))
+		if method == "OPTIONS" {
+			w.WriteStatusLine(response.StatusNoContent)
+			return
+		}
+		writeError(w, response.StatusMethodNotAllowed)
+		return
+	}
+
+	// Add the extracted parameters to the request object so the handler can
+	// access them. Parameters captured by a parent router are kept.
+	if r.PathParams == nil {
+		r.PathParams = make(map[string]string, len(params)/2)
+	}
+	for i := 0; i < len(params); i += 2 {
+		r.PathParams[params[i]] = params[i+1]
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// RecoveryMiddleware turns a panic in the handlers it wraps into a 500
+// Internal Server Error and logs the panic with its stack trace. If the
+// response had already started, it is aborted instead, since the client has
+// seen part of a successful one.
+func RecoveryMiddleware(next response.Handler) response.Handler {
+	return HandlerFunc(func(w *response.Writer, r *request.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			log.Printf("panic serving %s %s: %v\n%s", r.RequestLine.Method, r.RequestLine.RequestTarget, err, debug.Stack())
+			if !w.Reset() {
+				w.Abort()
+				return
+			}
+			writeError(w, response.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeError sends a plain-text response such as "404 Not Found".
+func writeError(w *response.Writer, status response.StatusCode) {
+	body := []byte(fmt.Sprintf("%d %s", status, response.StatusText(status)))
+	w.WriteStatusLine(status)
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "text/plain")
+	w.WriteHeaders(*h)
+	w.WriteBody(body)
+}
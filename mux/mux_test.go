@@ -0,0 +1,343 @@
+package mux
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"ray8118/httpfromtcp/headers"
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(method, target string) *request.Request {
+	return &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+		PathParams:  map[string]string{},
+	}
+}
+
+// serve routes a request through m and returns the parsed response.
+func serve(t *testing.T, m *Mux, method, target string) (*http.Response, string) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	if method == "HEAD" {
+		// As the server does for every HEAD request.
+		w.SuppressBody()
+	}
+	m.ServeHTTP(w, newRequest(method, target))
+	require.NoError(t, w.Finish())
+	res, err := http.ReadResponse(bufio.NewReader(buf), &http.Request{Method: method})
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body)
+}
+
+// reply returns a handler that answers with its name and the path params.
+func reply(name string) HandlerFunc {
+	return func(w *response.Writer, r *request.Request) {
+		w.WriteBody([]byte(fmt.Sprint(name, " ", r.PathParams)))
+	}
+}
+
+func TestRouting(t *testing.T) {
+	m := NewMux()
+	m.HandleFunc("GET", "/users/{id}", reply("user"))
+	m.HandleFunc("GET", "/users/me", reply("me"))
+	m.HandleFunc("GET", "/users/{id}/posts/{post}", reply("post"))
+	m.HandleFunc("GET", "/users/me/settings", reply("settings"))
+	m.HandleFunc("GET", "/", reply("root"))
+
+	// Test: Static segments win over parameters, whatever the order
+	_, body := serve(t, m, "GET", "/users/me")
+	assert.Equal(t, "me map[]", body)
+	_, body = serve(t, m, "GET", "/users/42")
+	assert.Equal(t, "user map[id:42]", body)
+
+	// Test: A static dead end falls back to the parameter branch
+	_, body = serve(t, m, "GET", "/users/me/posts/7")
+	assert.Equal(t, "post map[id:me post:7]", body)
+	_, body = serve(t, m, "GET", "/users/me/settings")
+	assert.Equal(t, "settings map[]", body)
+
+	// Test: Root and trailing slashes
+	_, body = serve(t, m, "GET", "/")
+	assert.Equal(t, "root map[]", body)
+	_, body = serve(t, m, "GET", "/users/42/")
+	assert.Equal(t, "user map[id:42]", body)
+
+	// Test: No match
+	res, _ := serve(t, m, "GET", "/nope")
+	assert.Equal(t, 404, res.StatusCode)
+	res, _ = serve(t, m, "GET", "/users/42/posts")
+	assert.Equal(t, 404, res.StatusCode)
+}
+
+func TestPatternSyntax(t *testing.T) {
+	m := NewMux()
+	m.HandleFunc("GET", "/items/{id:int}", reply("int"))
+	m.HandleFunc("GET", "/items/{slug:[a-z-]+}", reply("slug"))
+	m.HandleFunc("GET", "/items/{name}", reply("name"))
+	m.HandleFunc("GET", "/items/latest", reply("latest"))
+	m.HandleFunc("GET", "/files/{path...}", reply("files"))
+	m.HandleFunc("GET", "/files/{dir}/index", reply("index"))
+
+	// Test: Constraints take part in matching
+	_, body := serve(t, m, "GET", "/items/42")
+	assert.Equal(t, "int map[id:42]", body)
+	_, body = serve(t, m, "GET", "/items/hello-world")
+	assert.Equal(t, "slug map[slug:hello-world]", body)
+	_, body = serve(t, m, "GET", "/items/Hello_World")
+	assert.Equal(t, "name map[name:Hello_World]", body)
+
+	// Test: Static segments still win over constraints
+	_, body = serve(t, m, "GET", "/items/latest")
+	assert.Equal(t, "latest map[]", body)
+
+	// Test: Constraints must match the whole segment
+	m.HandleFunc("GET", "/orders/{id:[0-9]+}", reply("order"))
+	res, _ := serve(t, m, "GET", "/orders/12ab")
+	assert.Equal(t, 404, res.StatusCode)
+
+	// Test: A catch-all captures the rest of the path
+	_, body = serve(t, m, "GET", "/files/css/site/main.css")
+	assert.Equal(t, "files map[path:css/site/main.css]", body)
+	_, body = serve(t, m, "GET", "/files/docs/index")
+	assert.Equal(t, "index map[dir:docs]", body)
+	_, body = serve(t, m, "GET", "/files/docs/index/more")
+	assert.Equal(t, "files map[path:docs/index/more]", body)
+
+	// Test: A catch-all also matches nothing at all
+	_, body = serve(t, m, "GET", "/files")
+	assert.Equal(t, "files map[path:]", body)
+	_, body = serve(t, m, "GET", "/files/")
+	assert.Equal(t, "files map[path:]", body)
+}
+
+func TestRouteConflicts(t *testing.T) {
+	m := NewMux()
+	m.HandleFunc("GET", "/users/{id}", reply("user"))
+
+	// Test: The same route twice
+	assert.Panics(t, func() { m.HandleFunc("GET", "/users/{id}", reply("again")) })
+
+	// Test: Same position, different parameter name
+	assert.Panics(t, func() { m.HandleFunc("GET", "/users/{name}/posts", reply("posts")) })
+
+	// Test: Malformed patterns
+	assert.Panics(t, func() { m.HandleFunc("GET", "/a/{rest...}/b", reply("a")) })
+	assert.Panics(t, func() { m.HandleFunc("GET", "/a/{id:[0-9}", reply("a")) })
+	assert.Panics(t, func() { m.HandleFunc("GET", "/a/{...}", reply("a")) })
+
+	// Test: Same constraint, different parameter name
+	m.HandleFunc("GET", "/posts/{id:int}", reply("post"))
+	assert.Panics(t, func() { m.HandleFunc("GET", "/posts/{num:int}/edit", reply("edit")) })
+	assert.NotPanics(t, func() { m.HandleFunc("GET", "/posts/{slug:alpha}", reply("slug")) })
+
+	// Test: Same position, different catch-all name
+	m.HandleFunc("GET", "/files/{path...}", reply("files"))
+	assert.Panics(t, func() { m.HandleFunc("POST", "/files/{rest...}", reply("upload")) })
+
+	// Test: Another method on the same pattern is fine
+	assert.NotPanics(t, func() { m.HandleFunc("DELETE", "/users/{id}", reply("delete")) })
+}
+
+func TestMethodHandling(t *testing.T) {
+	m := NewMux()
+	m.HandleFunc("GET", "/items/{id}", reply("get"))
+	m.HandleFunc("DELETE", "/items/{id}", reply("delete"))
+	m.HandleFunc("POST", "/upload", reply("upload"))
+	m.HandleFunc("OPTIONS", "/custom", reply("custom options"))
+	m.HandleFunc("GET", "/custom", reply("custom"))
+	m.HandleFunc("POST", "/items/new", reply("create"))
+
+	// Test: A more specific pattern without the method falls through to one
+	// that has it
+	_, body := serve(t, m, "GET", "/items/new")
+	assert.Equal(t, "get map[id:new]", body)
+	_, body = serve(t, m, "POST", "/items/new")
+	assert.Equal(t, "create map[]", body)
+
+	// Test: Path matches but method does not
+	res, body := serve(t, m, "PUT", "/items/1")
+	assert.Equal(t, 405, res.StatusCode)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", res.Header.Get("Allow"))
+	assert.Equal(t, "405 Method Not Allowed", body)
+
+	// Test: Allow lists the methods of every pattern matching the path
+	res, _ = serve(t, m, "PUT", "/items/new")
+	assert.Equal(t, 405, res.StatusCode)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, POST", res.Header.Get("Allow"))
+
+	// Test: No HEAD without a GET handler
+	res, _ = serve(t, m, "HEAD", "/upload")
+	assert.Equal(t, 405, res.StatusCode)
+	assert.Equal(t, "OPTIONS, POST", res.Header.Get("Allow"))
+
+	// Test: OPTIONS is answered automatically
+	res, body = serve(t, m, "OPTIONS", "/items/1")
+	assert.Equal(t, 204, res.StatusCode)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", res.Header.Get("Allow"))
+	assert.Empty(t, body)
+
+	// Test: A registered OPTIONS handler takes over
+	_, body = serve(t, m, "OPTIONS", "/custom")
+	assert.Equal(t, "custom options map[]", body)
+
+	// Test: HEAD uses the GET handler without sending the body
+	res, body = serve(t, m, "HEAD", "/items/1")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, int64(len("get map[id:1]")), res.ContentLength)
+	assert.Empty(t, body)
+}
+
+// tag returns a middleware that appends name to the X-Trace header.
+func tag(name string) Middleware {
+	return func(next response.Handler) response.Handler {
+		return HandlerFunc(func(w *response.Writer, r *request.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestGroupsAndMounts(t *testing.T) {
+	m := NewMux()
+	m.HandleFunc("GET", "/public", reply("public"))
+	m.HandleFunc("GET", "/limited", reply("limited"), WithMiddleware(tag("route")))
+
+	admin := m.Group("/admin/", tag("admin"))
+	admin.HandleFunc("GET", "/", reply("dashboard"))
+	admin.HandleFunc("GET", "/users/{id}", reply("admin user"), WithMiddleware(tag("route")))
+	admin.Group("audit", tag("audit")).HandleFunc("GET", "/log", reply("log"))
+
+	v1 := NewMux()
+	v1.HandleFunc("GET", "/users/{id}", reply("v1 user"))
+	v1.HandleFunc("DELETE", "/users/{id}", reply("v1 delete"))
+	v1.HandleFunc("GET", "/x", reply("v1 x"))
+	m.Mount("/v1", v1)
+	m.HandleFunc("POST", "/v1/x", reply("direct x"))
+
+	v2 := NewMux()
+	v2.HandleFunc("GET", "/", reply("v2 root"))
+	m.Group("/api/{tenant}", tag("api")).Mount("/v2", v2)
+
+	// Test: Global routes see no group middleware
+	res, body := serve(t, m, "GET", "/public")
+	assert.Equal(t, "public map[]", body)
+	assert.Empty(t, res.Header.Values("X-Trace"))
+
+	// Test: Per-route middleware
+	res, _ = serve(t, m, "GET", "/limited")
+	assert.Equal(t, []string{"route"}, res.Header.Values("X-Trace"))
+
+	// Test: Group prefix and middleware, with route middleware running last
+	res, body = serve(t, m, "GET", "/admin")
+	assert.Equal(t, "dashboard map[]", body)
+	assert.Equal(t, []string{"admin"}, res.Header.Values("X-Trace"))
+	res, body = serve(t, m, "GET", "/admin/users/7")
+	assert.Equal(t, "admin user map[id:7]", body)
+	assert.Equal(t, []string{"admin", "route"}, res.Header.Values("X-Trace"))
+
+	// Test: Nested groups
+	res, body = serve(t, m, "GET", "/admin/audit/log")
+	assert.Equal(t, "log map[]", body)
+	assert.Equal(t, []string{"admin", "audit"}, res.Header.Values("X-Trace"))
+
+	// Test: A mounted router sees the path without its prefix
+	_, body = serve(t, m, "GET", "/v1/users/3")
+	assert.Equal(t, "v1 user map[id:3]", body)
+	_, body = serve(t, m, "DELETE", "/v1/users/3")
+	assert.Equal(t, "v1 delete map[id:3]", body)
+	res, _ = serve(t, m, "POST", "/v1/users/3")
+	assert.Equal(t, 405, res.StatusCode)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", res.Header.Get("Allow"))
+	res, _ = serve(t, m, "GET", "/v1/nope")
+	assert.Equal(t, 404, res.StatusCode)
+
+	// Test: A direct route takes its own method and leaves the rest to the mount
+	_, body = serve(t, m, "POST", "/v1/x")
+	assert.Equal(t, "direct x map[]", body)
+	res, body = serve(t, m, "GET", "/v1/x")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "v1 x map[]", body)
+
+	// Test: Mounting inside a group keeps the parent's params and middleware
+	res, body = serve(t, m, "GET", "/api/acme/v2")
+	assert.Equal(t, "v2 root map[tenant:acme]", body)
+	assert.Equal(t, []string{"api"}, res.Header.Values("X-Trace"))
+
+	// Test: The mount restores the full path for outer middleware
+	r := newRequest("GET", "/v1/users/3")
+	m.ServeHTTP(response.NewWriter(io.Discard), r)
+	assert.Equal(t, "/v1/users/3", r.RequestLine.RequestTarget)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	m := NewMux()
+	m.HandleFunc("GET", "/early", func(w *response.Writer, r *request.Request) {
+		w.Header().Set("X-Half-Done", "yes")
+		panic("boom")
+	})
+	m.HandleFunc("GET", "/late", func(w *response.Writer, r *request.Request) {
+		w.WriteBody([]byte("partial"))
+		w.Flush()
+		panic("boom")
+	})
+	h := Chain(m, RecoveryMiddleware)
+
+	// Test: A panic before the response started becomes a clean 500
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	require.NotPanics(t, func() { h.ServeHTTP(w, newRequest("GET", "/early")) })
+	require.NoError(t, w.Finish())
+	res, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Empty(t, res.Header.Get("X-Half-Done"))
+	assert.Equal(t, "500 Internal Server Error", string(body))
+	assert.True(t, w.KeepAlive())
+
+	// Test: A panic after the response started aborts it
+	buf = &bytes.Buffer{}
+	w = response.NewWriter(buf)
+	require.NotPanics(t, func() { h.ServeHTTP(w, newRequest("GET", "/late")) })
+	sent := buf.Len()
+	require.NoError(t, w.Finish())
+	assert.Equal(t, sent, buf.Len())
+	assert.False(t, w.KeepAlive())
+}
+
+// benchmarkMux registers n routes shaped like a typical REST API.
+func benchmarkMux(b *testing.B, n int) {
+	m := NewMux()
+	for i := 0; i < n; i++ {
+		m.HandleFunc("GET", fmt.Sprintf("/api/resource%d/{id}/items/{item}", i), reply("item"))
+		m.HandleFunc("GET", fmt.Sprintf("/api/resource%d/list", i), reply("list"))
+	}
+	// Look up the route registered last, the worst case for a linear scan.
+	r := newRequest("GET", fmt.Sprintf("/api/resource%d/42/items/7", n-1))
+	w := response.NewWriter(io.Discard)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkRouting10(b *testing.B)   { benchmarkMux(b, 10) }
+func BenchmarkRouting100(b *testing.B)  { benchmarkMux(b, 100) }
+func BenchmarkRouting1000(b *testing.B) { benchmarkMux(b, 1000) }
+func BenchmarkRouting2000(b *testing.B) { benchmarkMux(b, 2000) }
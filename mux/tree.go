@@ -0,0 +1,243 @@
+package mux
+
+import (
+	"fmt"
+	"ray8118/httpfromtcp/response"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// node is one path segment in the routing tree. Each registered pattern is
+// a path from the root, one node per segment. Lookups try a node's children
+// in a fixed order — static segments, then constrained parameters, then
+// plain parameters, then a catch-all — so the most specific route with a
+// handler for the request's method wins, whatever the registration order.
+type node struct {
+	// static holds the children matched by an exact segment.
+	static map[string]*node
+	// params holds the children matched by a single segment, e.g. "{id}" or
+	// "{id:[0-9]+}". Constrained parameters come first.
+	params []*node
+	// wildcard is the child matched by all remaining segments, e.g. "{path...}".
+	wildcard *node
+
+	// For parameter and wildcard nodes: the name the captured value is
+	// stored under, and the constraint it must satisfy, if any.
+	paramName  string
+	constraint string
+	re         *regexp.Regexp
+
+	// handlers holds the routes that end at this node, by method.
+	handlers map[string]response.Handler
+	// pattern is the pattern that created the routes at this node, used in
+	// conflict messages.
+	pattern string
+}
+
+func newNode() *node {
+	return &node{static: make(map[string]*node)}
+}
+
+// namedConstraints are shorthands accepted in place of a regular expression,
+// e.g. "{id:int}".
+var namedConstraints = map[string]string{
+	"int":   `[0-9]+`,
+	"alpha": `[A-Za-z]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// splitPath breaks a path into its segments, ignoring leading and trailing
+// slashes, e.g. "/users/{id}" becomes ["users", "{id}"].
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// isParam reports whether a pattern segment is a parameter like "{id}".
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// insert adds a route to the tree. It panics if the pattern is malformed or
+// the route conflicts with one registered earlier, since both are
+// programming errors.
+func (n *node) insert(method, pattern string, handler response.Handler) {
+	segments := splitPath(pattern)
+	current := n
+	for i, segment := range segments {
+		if !isParam(segment) {
+			child, ok := current.static[segment]
+			if !ok {
+				child = newNode()
+				current.static[segment] = child
+			}
+			current = child
+			continue
+		}
+
+		name, constraint, _ := strings.Cut(segment[1:len(segment)-1], ":")
+		if wildcard, ok := strings.CutSuffix(name, "..."); ok {
+			if i != len(segments)-1 || constraint != "" {
+				panic(fmt.Sprintf("mux: catch-all {%s} in pattern %q must be the unconstrained last segment", name, pattern))
+			}
+			current = current.wildcardChild(wildcard, pattern)
+			continue
+		}
+		current = current.paramChild(name, constraint, pattern)
+	}
+
+	if current.handlers == nil {
+		current.handlers = make(map[string]response.Handler)
+	}
+	if _, exists := current.handlers[method]; exists {
+		panic(fmt.Sprintf("mux: %s %s conflicts with %s %s", method, pattern, method, current.pattern))
+	}
+	current.handlers[method] = handler
+	current.pattern = pattern
+}
+
+// paramChild returns the child for a parameter segment, creating it if
+// needed. Parameters with the same constraint share a node, so they must
+// also share a name.
+func (n *node) paramChild(name, constraint, pattern string) *node {
+	if name == "" {
+		panic(fmt.Sprintf("mux: empty parameter name in pattern %q", pattern))
+	}
+	for _, child := range n.params {
+		if child.constraint != constraint {
+			continue
+		}
+		if child.paramName != name {
+			panic(fmt.Sprintf("mux: parameter {%s} in pattern %q conflicts with {%s} registered at the same position",
+				name, pattern, child.paramName))
+		}
+		return child
+	}
+
+	child := newNode()
+	child.paramName = name
+	child.constraint = constraint
+	if constraint != "" {
+		expr, ok := namedConstraints[constraint]
+		if !ok {
+			expr = constraint
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			panic(fmt.Sprintf("mux: invalid constraint for {%s} in pattern %q: %v", name, pattern, err))
+		}
+		child.re = re
+	}
+
+	// Keep constrained parameters ahead of the unconstrained one, each group
+	// in registration order.
+	at := len(n.params)
+	if constraint != "" {
+		for at > 0 && n.params[at-1].re == nil {
+			at--
+		}
+	}
+	n.params = append(n.params[:at], append([]*node{child}, n.params[at:]...)...)
+	return child
+}
+
+// wildcardChild returns the catch-all child, creating it if needed.
+func (n *node) wildcardChild(name, pattern string) *node {
+	if name == "" {
+		panic(fmt.Sprintf("mux: empty parameter name in pattern %q", pattern))
+	}
+	if n.wildcard == nil {
+		n.wildcard = newNode()
+		n.wildcard.paramName = name
+	} else if n.wildcard.paramName != name {
+		panic(fmt.Sprintf("mux: catch-all {%s...} in pattern %q conflicts with {%s...} registered at the same position",
+			name, pattern, n.wildcard.paramName))
+	}
+	return n.wildcard
+}
+
+// allowed returns the methods the given nodes answer between them,
+// including the HEAD and OPTIONS the mux provides automatically, in sorted
+// order.
+func allowed(nodes []*node) []string {
+	set := map[string]bool{"OPTIONS": true}
+	for _, n := range nodes {
+		for method := range n.handlers {
+			if method != anyMethod {
+				set[method] = true
+			}
+		}
+		if _, ok := n.handlers["GET"]; ok {
+			set["HEAD"] = true
+		}
+	}
+	methods := make([]string, 0, len(set))
+	for method := range set {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// handler returns the handler n has for method, if any: one registered for
+// the method itself, a mount that answers every method, or for HEAD the GET
+// handler, since the server drops the body of responses to HEAD.
+func (n *node) handler(method string) (response.Handler, bool) {
+	if h, ok := n.handlers[method]; ok {
+		return h, true
+	}
+	if h, ok := n.handlers[anyMethod]; ok {
+		return h, true
+	}
+	if method == "HEAD" {
+		h, ok := n.handlers["GET"]
+		return h, ok
+	}
+	return nil, false
+}
+
+// match calls visit on every node with routes that matches the path, most
+// specific first, with params holding the names and values captured to reach
+// it. It stops and reports true as soon as visit does, leaving params as they
+// were for that node; a node that does not suit the caller, for example
+// because it lacks the request's method, is backtracked over so that less
+// specific patterns still get their turn.
+func (n *node) match(segments []string, params *[]string, visit func(*node) bool) bool {
+	if len(segments) == 0 {
+		if n.handlers != nil && visit(n) {
+			return true
+		}
+		// A catch-all also matches when nothing is left, e.g. "/static".
+		return n.wildcard.matchRest(nil, params, visit)
+	}
+
+	segment, rest := segments[0], segments[1:]
+	if child, ok := n.static[segment]; ok && child.match(rest, params, visit) {
+		return true
+	}
+	for _, child := range n.params {
+		if child.re != nil && !child.re.MatchString(segment) {
+			continue
+		}
+		*params = append(*params, child.paramName, segment)
+		if child.match(rest, params, visit) {
+			return true
+		}
+		*params = (*params)[:len(*params)-2]
+	}
+	return n.wildcard.matchRest(segments, params, visit)
+}
+
+// matchRest offers the remaining segments to a catch-all node, which may be
+// nil.
+func (n *node) matchRest(segments []string, params *[]string, visit func(*node) bool) bool {
+	if n == nil || n.handlers == nil {
+		return false
+	}
+	*params = append(*params, n.paramName, strings.Join(segments, "/"))
+	if visit(n) {
+		return true
+	}
+	*params = (*params)[:len(*params)-2]
+	return false
+}
@@ -0,0 +1,250 @@
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"ray8118/httpfromtcp/headers"
+	"strings"
+)
+
+// maxDrainBytes is how much unread body Close is willing to discard so the
+// connection can be reused. Anything larger is cheaper to abandon along with
+// the connection.
+const maxDrainBytes = 256 << 10
+
+var ErrorBodyReadAfterClose = fmt.Errorf("read on closed request body")
+var ErrorBodyNotDrained = fmt.Errorf("request body too large to drain")
+var ErrorForbiddenTrailer = fmt.Errorf("field not allowed in trailers")
+
+// forbiddenTrailers are the fields RFC 9110 section 6.5.1 keeps out of a
+// trailer section: those that frame or route the message, modify or
+// authenticate the request, or say how to process the content. All of them
+// must be known before the body is read, so a late copy could only be used
+// to make two parsers disagree.
+var forbiddenTrailers = map[string]bool{
+	"content-length":      true,
+	"transfer-encoding":   true,
+	"trailer":             true,
+	"host":                true,
+	"connection":          true,
+	"keep-alive":          true,
+	"upgrade":             true,
+	"te":                  true,
+	"expect":              true,
+	"max-forwards":        true,
+	"range":               true,
+	"if-match":            true,
+	"if-none-match":       true,
+	"if-modified-since":   true,
+	"if-unmodified-since": true,
+	"if-range":            true,
+	"cache-control":       true,
+	"pragma":              true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"content-encoding":    true,
+	"content-type":        true,
+	"content-range":       true,
+}
+
+// checkTrailers rejects a trailer section holding any forbidden field.
+func (r *Request) checkTrailers() error {
+	var err error
+	r.Trailers.ForEach(func(n, v string) {
+		if err == nil && forbiddenTrailers[strings.ToLower(n)] {
+			err = fmt.Errorf("%w: %s", ErrorForbiddenTrailer, n)
+		}
+	})
+	return err
+}
+
+// body is the io.ReadCloser behind Request.Body. It decodes the body straight
+// from the connection buffer as the handler reads it.
+type body struct {
+	request *Request
+	src     *Reader
+	closed  bool
+}
+
+// Read decodes up to len(p) bytes of the body, fetching more data from the
+// connection as needed.
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrorBodyReadAfterClose
+	}
+	return b.read(p)
+}
+
+func (b *body) read(p []byte) (int, error) {
+	r := b.request
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		switch r.state {
+		case stateDone:
+			return 0, io.EOF
+		case stateError:
+			return 0, ErrorRequestInErrorState
+		}
+
+		consumed, written, err := r.decodeBody(b.src.buf[:b.src.n], p)
+		b.src.consume(consumed)
+		if err != nil {
+			return written, err
+		}
+		if written > 0 {
+			return written, nil
+		}
+		if r.state == stateDone {
+			return 0, io.EOF
+		}
+
+		if err := b.src.fill(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			r.state = stateError
+			return 0, err
+		}
+	}
+}
+
+// Close discards whatever the handler left unread so the next request on the
+// connection starts in the right place. If more than maxDrainBytes remain, or
+// the body is broken, it gives up and returns an error; the connection then
+// cannot be reused.
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	if b.request.state == stateDone {
+		return nil
+	}
+
+	buf := make([]byte, 4096)
+	drained := 0
+	for drained <= maxDrainBytes {
+		n, err := b.read(buf)
+		drained += n
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	b.request.state = stateError
+	return ErrorBodyNotDrained
+}
+
+// decodeBody is the body half of the parser's state machine. It decodes data
+// into p and returns how many bytes of data it consumed and how many it wrote
+// to p. It stops when p is full, data runs out or the body ends.
+func (r *Request) decodeBody(data []byte, p []byte) (int, int, error) {
+	read := 0
+	written := 0
+outer:
+	for {
+		currentData := data[read:]
+		if len(currentData) == 0 {
+			break outer
+		}
+
+		switch r.state {
+		case stateBody:
+			n := min(r.contentLength-r.bodyBytes, min(len(p)-written, len(currentData)))
+			copy(p[written:], currentData[:n])
+			r.bodyBytes += n
+			written += n
+			read += n
+			if r.bodyBytes == r.contentLength {
+				r.state = stateDone
+			}
+			if written == len(p) {
+				break outer
+			}
+
+		case stateChunkSize:
+			idx := bytes.Index(currentData, crlf)
+			if idx == -1 {
+				if len(currentData) > maxChunkLineBytes {
+					r.state = stateError
+					return read, written, ErrorMalformedChunkSize
+				}
+				break outer
+			}
+			size, err := parseChunkSize(currentData[:idx])
+			if err != nil {
+				r.state = stateError
+				return read, written, err
+			}
+			if size > r.opts.MaxBodyBytes-r.bodyBytes {
+				r.state = stateError
+				return read, written, ErrorBodyTooLarge
+			}
+			r.bodyBytes += size
+			read += idx + len(crlf)
+			r.chunkRemaining = size
+			if size == 0 {
+				r.state = stateTrailers
+			} else {
+				r.state = stateChunkData
+			}
+
+		case stateChunkData:
+			n := min(r.chunkRemaining, min(len(p)-written, len(currentData)))
+			copy(p[written:], currentData[:n])
+			r.chunkRemaining -= n
+			written += n
+			read += n
+			if r.chunkRemaining == 0 {
+				r.state = stateChunkDataEnd
+			}
+			if written == len(p) {
+				break outer
+			}
+
+		case stateChunkDataEnd:
+			if len(currentData) < len(crlf) {
+				break outer
+			}
+			if !bytes.HasPrefix(currentData, crlf) {
+				r.state = stateError
+				return read, written, ErrorMalformedChunk
+			}
+			read += len(crlf)
+			r.state = stateChunkSize
+
+		case stateTrailers:
+			n, done, err := r.Trailers.Parse(currentData)
+			if err != nil {
+				r.state = stateError
+				return read, written, err
+			}
+			if err := r.countHeaderBytes(currentData, n, done); err != nil {
+				return read, written, err
+			}
+			if n == 0 {
+				break outer
+			}
+			read += n
+			if done {
+				if err := r.checkTrailers(); err != nil {
+					// Keep the rejected fields away from anyone who looks anyway.
+					r.Trailers = headers.NewHeaders()
+					r.state = stateError
+					return read, written, err
+				}
+				r.state = stateDone
+			}
+
+		default:
+			break outer
+		}
+	}
+	return read, written, nil
+}
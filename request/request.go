@@ -0,0 +1,717 @@
+// Package request parses HTTP/1.1 requests from a byte stream and exposes
+// the request line, headers and a streaming body to handlers.
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"ray8118/httpfromtcp/headers"
+	"strconv"
+	"strings"
+)
+
+// parserState represents the current state of our HTTP request parser.
+type parserState string
+
+const (
+	stateInit    parserState = "init"
+	stateHeaders parserState = "headers"
+	stateBody    parserState = "body"
+	// The chunked states walk through each "size CRLF data CRLF" chunk and
+	// the trailer section that follows the final zero-size chunk.
+	stateChunkSize    parserState = "chunk-size"
+	stateChunkData    parserState = "chunk-data"
+	stateChunkDataEnd parserState = "chunk-data-end"
+	stateTrailers     parserState = "trailers"
+	stateDone         parserState = "done"
+	stateError        parserState = "error"
+)
+
+// RequestLine holds the parsed components of the first line of an HTTP request.
+type RequestLine struct {
+	HttpVersion string
+	// RequestTarget is what the request is routed on: the path, without the
+	// query, for origin-form ("/x?y") and absolute-form
+	// ("http://example.com/x") targets, the authority for CONNECT
+	// ("example.com:443") and "*" for a server-wide OPTIONS. The full target
+	// is in Request.URL.
+	RequestTarget string
+	Method        string
+}
+
+// Request represents a parsed HTTP request.
+type Request struct {
+	RequestLine RequestLine
+	Headers     *headers.Headers
+	// Body streams the request body from the connection as it is read. It is
+	// never nil; a request without a body yields io.EOF immediately.
+	Body       io.ReadCloser
+	PathParams map[string]string
+	Query      url.Values
+	// URL is the parsed request target. Scheme and Host are only set when
+	// the client sent them in the target itself, as proxy clients do.
+	URL *url.URL
+	// Host is the host the request is for: the authority from an
+	// absolute-form or CONNECT target if there is one, otherwise the Host
+	// header, which HTTP/1.1 clients must send. It is empty only for an
+	// HTTP/1.0 request that names no host.
+	Host string
+	// Trailers holds the fields sent after the last chunk of a chunked body.
+	// It is only populated once Body has been read to the end. Fields that
+	// may not appear in trailers, such as Content-Length or Host, make the
+	// read fail with ErrorForbiddenTrailer instead.
+	Trailers *headers.Headers
+	state    parserState
+	// chunkRemaining is the number of data bytes left in the current chunk.
+	chunkRemaining int
+	// opts holds the size limits the parser enforces, with defaults applied.
+	opts Options
+	// headerBytes and headerCount track how much of the limits the header
+	// and trailer sections have used so far.
+	headerBytes int
+	headerCount int
+	// contentLength is the declared body length for non-chunked bodies.
+	contentLength int
+	// bodyBytes is the number of body bytes received so far.
+	bodyBytes int
+}
+
+// newRequest creates and initializes a new Request object.
+func newRequest() *Request {
+	return &Request{
+		state:      stateInit,
+		Headers:    headers.NewHeaders(),
+		Trailers:   headers.NewHeaders(),
+		PathParams: make(map[string]string),
+		Query:      make(url.Values), // Correct initialization
+		URL:        &url.URL{},
+	}
+}
+
+var ErrorMalformedRequestLine = fmt.Errorf("malformed request line")
+var ErrorUnsupportedHttpVersion = fmt.Errorf("unsupported http version")
+var ErrorRequestInErrorState = fmt.Errorf("request in error state")
+var ErrorMalformedChunkSize = fmt.Errorf("malformed chunk size")
+var ErrorMalformedChunkExtension = fmt.Errorf("malformed chunk extension")
+var ErrorMalformedChunk = fmt.Errorf("malformed chunk")
+var ErrorRequestLineTooLong = fmt.Errorf("request line too long")
+var ErrorHeadersTooLarge = fmt.Errorf("request header fields too large")
+var ErrorBodyTooLarge = fmt.Errorf("request body too large")
+var ErrorInvalidContentLength = fmt.Errorf("invalid content length")
+var ErrorAmbiguousFraming = fmt.Errorf("ambiguous message framing")
+var ErrorUnsupportedTransferEncoding = fmt.Errorf("unsupported transfer encoding")
+var ErrorInvalidRequestTarget = fmt.Errorf("invalid request target")
+var ErrorInvalidHost = fmt.Errorf("invalid host")
+var crlf = []byte("\r\n")
+
+// parseHTTPVersion parses the "major.minor" part of an HTTP-version such as
+// "HTTP/1.1". Each number is a single digit.
+func parseHTTPVersion(version string) (int, int, bool) {
+	if len(version) != 3 || version[1] != '.' || !isDigit(version[0]) || !isDigit(version[2]) {
+		return 0, 0, false
+	}
+	return int(version[0] - '0'), int(version[2] - '0'), true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Proto returns the major and minor HTTP version of the request, e.g. 1 and
+// 0 for HTTP/1.0.
+func (rl RequestLine) Proto() (int, int) {
+	major, minor, _ := parseHTTPVersion(rl.HttpVersion)
+	return major, minor
+}
+
+// ProtoAtLeast reports whether the request uses at least the given HTTP
+// version.
+func (rl RequestLine) ProtoAtLeast(major, minor int) bool {
+	m, n := rl.Proto()
+	return m > major || m == major && n >= minor
+}
+
+// parseRequestLine parses the first line of an HTTP request, returning the
+// parsed request target along with it.
+func parseRequestLine(b []byte) (*RequestLine, int, *url.URL, error) {
+	idx := bytes.IndexByte(b, '\n')
+	if idx == -1 {
+		return nil, 0, nil, nil
+	}
+	// A bare LF ends the line for some parsers and not for others.
+	if idx == 0 || b[idx-1] != '\r' {
+		return nil, 0, nil, ErrorMalformedRequestLine
+	}
+	idx--
+
+	startLine := b[:idx]
+	read := idx + len(crlf)
+
+	// A bare CR or LF, or any other control character, could end the line
+	// early for some other parser on the way here.
+	for _, c := range startLine {
+		if c < ' ' || c == 0x7f {
+			return nil, 0, nil, ErrorMalformedRequestLine
+		}
+	}
+	parts := bytes.Split(startLine, []byte(" "))
+	if len(parts) != 3 || !isToken(parts[0]) {
+		return nil, 0, nil, ErrorMalformedRequestLine
+	}
+
+	version, ok := bytes.CutPrefix(parts[2], []byte("HTTP/"))
+	if !ok {
+		return nil, 0, nil, ErrorMalformedRequestLine
+	}
+	major, _, ok := parseHTTPVersion(string(version))
+	if !ok {
+		return nil, 0, nil, ErrorMalformedRequestLine
+	}
+	if major != 1 {
+		return nil, 0, nil, ErrorUnsupportedHttpVersion
+	}
+
+	method := string(parts[0])
+	u, path, err := parseRequestTarget(method, string(parts[1]))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	rl := &RequestLine{
+		Method:        method,
+		RequestTarget: path,
+		HttpVersion:   string(version),
+	}
+
+	return rl, read, u, nil
+}
+
+// parseRequestTarget parses a request target in whichever of the four forms
+// of RFC 9112 section 3.2 the method calls for. It returns the target as a
+// URL and the path the request is routed on.
+func parseRequestTarget(method, target string) (*url.URL, string, error) {
+	invalid := func() error {
+		return fmt.Errorf("%w: %q", ErrorInvalidRequestTarget, target)
+	}
+	switch {
+	case method == "CONNECT":
+		// authority-form: "host:port" and nothing else.
+		host, port, err := net.SplitHostPort(target)
+		if err != nil || host == "" || port == "" || !validHost(target) {
+			return nil, "", invalid()
+		}
+		return &url.URL{Host: target}, target, nil
+
+	case target == "*":
+		// asterisk-form, for OPTIONS on the server as a whole.
+		if method != "OPTIONS" {
+			return nil, "", invalid()
+		}
+		return &url.URL{Path: "*"}, "*", nil
+
+	case strings.HasPrefix(target, "/"):
+		// origin-form: an absolute path and an optional query.
+		u, err := url.ParseRequestURI(target)
+		if err != nil || strings.Contains(target, "#") {
+			return nil, "", invalid()
+		}
+		path, _, _ := strings.Cut(target, "?")
+		return u, path, nil
+
+	default:
+		// absolute-form: a full URI, as sent to proxies.
+		u, err := url.ParseRequestURI(target)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Opaque != "" || u.User != nil ||
+			!validHost(u.Host) || strings.Contains(target, "#") {
+			return nil, "", invalid()
+		}
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		return u, path, nil
+	}
+}
+
+// validHost reports whether h only holds characters allowed in the authority
+// of a URI: a registered name or IP literal, optionally with a port.
+func validHost(h string) bool {
+	for i := 0; i < len(h); i++ {
+		c := h[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.IndexByte("-._~!$&'()*+,;=%:[]", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveHost works out the host the request is for once the headers are
+// in. A host in the request target overrides the Host header, as RFC 9112
+// requires, but the header must still be well-formed and appear exactly
+// once in HTTP/1.1, so that no two parsers can pick different hosts.
+func (r *Request) resolveHost() error {
+	hosts := r.Headers.Values("host")
+	if len(hosts) > 1 {
+		return fmt.Errorf("%w: more than one host header", ErrorInvalidHost)
+	}
+	if len(hosts) == 0 && r.RequestLine.ProtoAtLeast(1, 1) {
+		return fmt.Errorf("%w: missing host header", ErrorInvalidHost)
+	}
+	if len(hosts) == 1 {
+		if !validHost(hosts[0]) {
+			return fmt.Errorf("%w: %q", ErrorInvalidHost, hosts[0])
+		}
+		r.Host = hosts[0]
+	}
+	if r.URL.Host != "" {
+		r.Host = r.URL.Host
+	}
+	return nil
+}
+
+// parseContentLength returns the body length declared by the Content-Length
+// fields, or -1 if there are none. The field may be repeated, or hold a list,
+// only if every value is the same; anything else could be read differently
+// by a proxy in front of us, so it is rejected instead of guessed at.
+func parseContentLength(h *headers.Headers) (int, error) {
+	length := -1
+	for _, v := range h.Values("content-length") {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			// Only plain digits: ParseInt would also accept a sign.
+			if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+				return 0, fmt.Errorf("%w: %q", ErrorInvalidContentLength, v)
+			}
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%w: %q", ErrorInvalidContentLength, v)
+			}
+			if length != -1 && int(n) != length {
+				return 0, fmt.Errorf("%w: conflicting values", ErrorInvalidContentLength)
+			}
+			length = int(n)
+		}
+	}
+	return length, nil
+}
+
+// framing decides how the body is delimited, following RFC 9112 section 6.
+// Chunked is the only transfer coding we decode, and it may not be combined
+// with a Content-Length or sent by an HTTP/1.0 client, since those are the
+// classic ways to make a proxy and a server disagree on where a request ends.
+func (r *Request) framing() (chunked bool, length int, err error) {
+	codings := r.Headers.Values("transfer-encoding")
+	length, err = parseContentLength(r.Headers)
+	if err != nil {
+		return false, 0, err
+	}
+	if len(codings) == 0 {
+		return false, max(length, 0), nil
+	}
+	if !r.RequestLine.ProtoAtLeast(1, 1) {
+		return false, 0, fmt.Errorf("%w: transfer-encoding in an HTTP/1.0 request", ErrorAmbiguousFraming)
+	}
+	if length != -1 {
+		return false, 0, fmt.Errorf("%w: both transfer-encoding and content-length", ErrorAmbiguousFraming)
+	}
+	if len(codings) != 1 || !strings.EqualFold(strings.TrimSpace(codings[0]), "chunked") {
+		return false, 0, fmt.Errorf("%w: %q", ErrorUnsupportedTransferEncoding, strings.Join(codings, ", "))
+	}
+	return true, 0, nil
+}
+
+// isTokenChar reports whether c may appear in an RFC 9110 token.
+func isTokenChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// isToken reports whether b is a non-empty RFC 9110 token, such as a method.
+func isToken(b []byte) bool {
+	for _, c := range b {
+		if !isTokenChar(c) {
+			return false
+		}
+	}
+	return len(b) > 0
+}
+
+// parseChunkExtensions validates the ";name=value" list that may follow a
+// chunk size. Extensions carry no meaning for us, so they are checked for
+// syntax and then ignored, as RFC 9112 allows.
+func parseChunkExtensions(ext []byte) error {
+	i := 0
+	skipSpace := func() {
+		for i < len(ext) && (ext[i] == ' ' || ext[i] == '\t') {
+			i++
+		}
+	}
+	token := func() bool {
+		start := i
+		for i < len(ext) && isTokenChar(ext[i]) {
+			i++
+		}
+		return i > start
+	}
+
+	for {
+		skipSpace()
+		if i == len(ext) {
+			return nil
+		}
+		if ext[i] != ';' {
+			return ErrorMalformedChunkExtension
+		}
+		i++
+		skipSpace()
+		if !token() {
+			return ErrorMalformedChunkExtension
+		}
+		skipSpace()
+		if i == len(ext) || ext[i] != '=' {
+			continue
+		}
+		i++
+		skipSpace()
+		if i < len(ext) && ext[i] == '"' {
+			// quoted-string, honouring backslash escapes
+			i++
+			for i < len(ext) && ext[i] != '"' {
+				if ext[i] == '\\' {
+					i++
+				}
+				if i < len(ext) && (ext[i] < ' ' && ext[i] != '\t' || ext[i] == 0x7f) {
+					return ErrorMalformedChunkExtension
+				}
+				i++
+			}
+			if i >= len(ext) {
+				return ErrorMalformedChunkExtension
+			}
+			i++
+		} else if !token() {
+			return ErrorMalformedChunkExtension
+		}
+	}
+}
+
+// parseChunkSize parses a "size[;extensions]" chunk header line.
+func parseChunkSize(line []byte) (int, error) {
+	sizeEnd := 0
+	for sizeEnd < len(line) && strings.IndexByte("0123456789abcdefABCDEF", line[sizeEnd]) >= 0 {
+		sizeEnd++
+	}
+	// More than 15 hex digits could overflow an int64.
+	if sizeEnd == 0 || sizeEnd > 15 {
+		return 0, ErrorMalformedChunkSize
+	}
+	size, err := strconv.ParseInt(string(line[:sizeEnd]), 16, 64)
+	if err != nil {
+		return 0, ErrorMalformedChunkSize
+	}
+	if err := parseChunkExtensions(line[sizeEnd:]); err != nil {
+		return 0, err
+	}
+	return int(size), nil
+}
+
+// parse is the core state machine for parsing an HTTP request. It stops once
+// the headers are complete; the body is left for the body reader.
+func (r *Request) parse(data []byte) (int, error) {
+	read := 0
+outer:
+	for {
+		currentData := data[read:]
+		if len(currentData) == 0 {
+			break outer
+		}
+
+		switch r.state {
+		case stateError:
+			return 0, ErrorRequestInErrorState
+
+		case stateInit:
+			// Empty lines before the request line are ignored (RFC 9112
+			// section 2.2); some clients send one after a request body.
+			if bytes.HasPrefix(currentData, crlf) {
+				read += len(crlf)
+				continue
+			}
+			// Capture all return values from parseRequestLine
+			rl, n, u, err := parseRequestLine(currentData)
+			if err != nil {
+				r.state = stateError
+				return 0, err
+			}
+			if n == 0 {
+				if len(currentData) > r.opts.MaxRequestLineBytes {
+					r.state = stateError
+					return 0, ErrorRequestLineTooLong
+				}
+				break outer
+			}
+			if n-len(crlf) > r.opts.MaxRequestLineBytes {
+				r.state = stateError
+				return 0, ErrorRequestLineTooLong
+			}
+			// Assign the parsed values
+			r.RequestLine = *rl
+			r.URL = u
+			if query, err := url.ParseQuery(u.RawQuery); err == nil {
+				r.Query = query
+			}
+			read += n
+			r.state = stateHeaders
+
+		case stateHeaders:
+			n, done, err := r.Headers.Parse(currentData)
+			if err != nil {
+				r.state = stateError
+				return 0, err
+			}
+			if err := r.countHeaderBytes(currentData, n, done); err != nil {
+				return 0, err
+			}
+			if n == 0 {
+				break outer
+			}
+			read += n
+			if done {
+				if err := r.resolveHost(); err != nil {
+					r.state = stateError
+					return 0, err
+				}
+				chunked, length, err := r.framing()
+				if err != nil {
+					r.state = stateError
+					return 0, err
+				}
+				if length > r.opts.MaxBodyBytes {
+					r.state = stateError
+					return 0, ErrorBodyTooLarge
+				}
+				r.contentLength = length
+				if chunked {
+					r.state = stateChunkSize
+				} else if length > 0 {
+					r.state = stateBody
+				} else {
+					r.state = stateDone
+				}
+			}
+
+		default:
+			// Everything past the headers is decoded lazily by the body reader.
+			break outer
+		}
+	}
+	return read, nil
+}
+
+// countHeaderBytes charges a header or trailer parse step against the size
+// and count limits. n is how much of data the step consumed. Until the
+// section is done, data beyond n is an incomplete field line that still
+// counts towards the byte limit; after it, that data is the body or the next
+// request and is none of the section's business.
+func (r *Request) countHeaderBytes(data []byte, n int, done bool) error {
+	fields := bytes.Count(data[:n], crlf)
+	pending := len(data) - n
+	if done {
+		fields--
+		pending = 0
+	}
+	r.headerBytes += n
+	r.headerCount += fields
+	if r.headerBytes+pending > r.opts.MaxHeaderBytes || r.headerCount > r.opts.MaxHeaderCount {
+		r.state = stateError
+		return ErrorHeadersTooLarge
+	}
+	return nil
+}
+
+// KeepAlive reports whether the client is willing to reuse the connection for
+// further requests. HTTP/1.1 connections are persistent unless the client sent
+// "Connection: close"; HTTP/1.0 ones only if it sent "Connection: keep-alive".
+func (r *Request) KeepAlive() bool {
+	if r.Headers.HasToken("connection", "close") {
+		return false
+	}
+	return r.RequestLine.ProtoAtLeast(1, 1) || r.Headers.HasToken("connection", "keep-alive")
+}
+
+// ExpectsContinue reports whether the client sent "Expect: 100-continue" and
+// will wait for a 100 Continue before sending the body. HTTP/1.0 clients
+// cannot take part in this exchange, so the header is ignored for them.
+func (r *Request) ExpectsContinue() bool {
+	expect, ok := r.Headers.Get("expect")
+	return ok && strings.EqualFold(strings.TrimSpace(expect), "100-continue") && r.RequestLine.ProtoAtLeast(1, 1)
+}
+
+// pastHeaders reports whether the request line and headers have been parsed.
+func (r *Request) pastHeaders() bool {
+	return r.state != stateInit && r.state != stateHeaders
+}
+
+// ReadBody reads the rest of the body into memory. It is a convenience for
+// small payloads; large uploads should be streamed from Body instead.
+func (r *Request) ReadBody() ([]byte, error) {
+	return io.ReadAll(r.Body)
+}
+
+// Default limits applied by Reader when the corresponding Options field
+// is zero.
+const (
+	DefaultMaxRequestLineBytes = 8 << 10
+	DefaultMaxHeaderBytes      = 1 << 20
+	DefaultMaxHeaderCount      = 100
+	DefaultMaxBodyBytes        = 10 << 20
+)
+
+// maxChunkLineBytes bounds a chunk size line, extensions included.
+const maxChunkLineBytes = 4 << 10
+
+// Options tunes how a Reader parses requests.
+type Options struct {
+	// MaxRequestLineBytes limits the length of the request line, excluding
+	// the CRLF. Longer lines fail with ErrorRequestLineTooLong.
+	MaxRequestLineBytes int
+	// MaxHeaderBytes limits the combined size of the header (and trailer)
+	// section. Larger sections fail with ErrorHeadersTooLarge.
+	MaxHeaderBytes int
+	// MaxHeaderCount limits the number of header (and trailer) field lines.
+	// More fields fail with ErrorHeadersTooLarge.
+	MaxHeaderCount int
+	// MaxBodyBytes limits the size of the request body. A larger declared
+	// Content-Length fails ReadRequest with ErrorBodyTooLarge; a chunked body
+	// that grows too large fails the read from Body instead.
+	MaxBodyBytes int
+}
+
+// withDefaults returns a copy of o with every unset limit filled in.
+func (o Options) withDefaults() Options {
+	if o.MaxRequestLineBytes <= 0 {
+		o.MaxRequestLineBytes = DefaultMaxRequestLineBytes
+	}
+	if o.MaxHeaderBytes <= 0 {
+		o.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	if o.MaxHeaderCount <= 0 {
+		o.MaxHeaderCount = DefaultMaxHeaderCount
+	}
+	if o.MaxBodyBytes <= 0 {
+		o.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	return o
+}
+
+// Reader reads successive requests from a single connection. It buffers the
+// connection so the header parser and the body readers can share bytes that
+// arrive together, and keeps whatever is left over for the next request, so
+// pipelined requests are read back in the order they were sent.
+type Reader struct {
+	reader io.Reader
+	opts   Options
+	buf    []byte
+	n      int // number of valid bytes in buf
+	// last is the most recent request, whose body must be finished before
+	// the next request can be parsed.
+	last *Request
+}
+
+// NewReader returns a Reader that parses requests from reader.
+func NewReader(reader io.Reader, opts Options) *Reader {
+	return &Reader{
+		reader: reader,
+		opts:   opts.withDefaults(),
+		buf:    make([]byte, 1024),
+	}
+}
+
+// fill reads more data from the underlying reader. A full buffer means the
+// parser needs more data than it holds to make progress; the parser's limits
+// keep this growth bounded.
+func (rr *Reader) fill() error {
+	if rr.n == len(rr.buf) {
+		grown := make([]byte, len(rr.buf)*2)
+		copy(grown, rr.buf[:rr.n])
+		rr.buf = grown
+	}
+	n, err := rr.reader.Read(rr.buf[rr.n:])
+	rr.n += n
+	if n > 0 {
+		// Hand over the data first; a sticky error will come back next time.
+		return nil
+	}
+	return err
+}
+
+// consume drops the first n buffered bytes once the parser has used them.
+func (rr *Reader) consume(n int) {
+	copy(rr.buf, rr.buf[n:rr.n])
+	rr.n -= n
+}
+
+// Buffered returns the number of bytes already read from the connection but
+// not yet parsed.
+func (rr *Reader) Buffered() int {
+	return rr.n
+}
+
+// ReadRequest parses the request line and headers of the next request. The
+// body is not read; it is streamed from the returned request's Body. Any part
+// of the previous request's body that was left unread is discarded first.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	if rr.last != nil {
+		if err := rr.last.Body.Close(); err != nil {
+			return nil, err
+		}
+		rr.last = nil
+	}
+
+	request := newRequest()
+	request.opts = rr.opts
+	for {
+		readN, err := request.parse(rr.buf[:rr.n])
+		if err != nil {
+			return nil, err
+		}
+		rr.consume(readN)
+		if request.pastHeaders() {
+			break
+		}
+
+		if err := rr.fill(); err != nil {
+			// A peer that hangs up before sending anything has simply finished
+			// with the connection; report that as a clean io.EOF.
+			if err == io.EOF && request.state == stateInit && rr.n == 0 {
+				return nil, io.EOF
+			}
+			if err == io.EOF {
+				return nil, fmt.Errorf("connection closed unexpectedly")
+			}
+			return nil, err
+		}
+	}
+
+	request.Body = &body{request: request, src: rr}
+	rr.last = request
+	return request, nil
+}
+
+// RequestFromReader reads from an io.Reader and parses a single Request.
+// Bytes read past the end of the request are discarded; use a Reader to
+// parse several requests from one connection.
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	return NewReader(reader, Options{}).ReadRequest()
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,557 @@
+package request
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"ray8118/httpfromtcp/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+// Read reads up to len(p) or numBytesPerRead bytes from the string per call
+// its useful for simulating reading a variable number of bytes per chunk from a network connection
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	if cr.pos >= len(cr.data) {
+		return 0, io.EOF
+	}
+	endIndex := cr.pos + cr.numBytesPerRead
+	if endIndex > len(cr.data) {
+		endIndex = len(cr.data)
+	}
+	n = copy(p, cr.data[cr.pos:endIndex])
+	cr.pos += n
+
+	return n, nil
+}
+
+func TestRequestLineParse(t *testing.T) {
+	// Test: Good GET Request line
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+	assert.Equal(t, "/", r.RequestLine.RequestTarget)
+	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
+
+	// Test: Good GET Request line with path
+	reader = &chunkReader{
+		data:            "GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
+
+	// Test: Empty lines before the request line are ignored
+	reader = &chunkReader{
+		data:            "\r\n\r\nGET /late HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/late", r.RequestLine.RequestTarget)
+
+	// Test: HTTP/1.0 closes unless the client asks for keep-alive
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.RequestLine.ProtoAtLeast(1, 1))
+	assert.False(t, r.KeepAlive())
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: Later HTTP/1.x minor versions are accepted
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.2\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.RequestLine.ProtoAtLeast(1, 1))
+	assert.True(t, r.KeepAlive())
+
+	// Test: Other major versions are unsupported
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/2.0\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrorUnsupportedHttpVersion)
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/0.9\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrorUnsupportedHttpVersion)
+
+	// Test: Malformed versions
+	for _, version := range []string{"HTTP/1", "HTTP/1.10", "HTTP/x.y", "HTTPS/1.1", "http/1.1"} {
+		_, err = RequestFromReader(strings.NewReader("GET / " + version + "\r\n\r\n"))
+		assert.ErrorIs(t, err, ErrorMalformedRequestLine, version)
+	}
+}
+
+func TestRequestTargetForms(t *testing.T) {
+	// Test: origin-form keeps the raw path and splits off the query
+	r, err := RequestFromReader(strings.NewReader("GET /a%2Fb/c?x=1&y=2 HTTP/1.1\r\nHost: example.com:8080\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "/a%2Fb/c", r.RequestLine.RequestTarget)
+	assert.Equal(t, "/a/b/c", r.URL.Path)
+	assert.Equal(t, "/a%2Fb/c", r.URL.RawPath)
+	assert.Equal(t, "x=1&y=2", r.URL.RawQuery)
+	assert.Equal(t, "", r.URL.Host)
+	assert.Equal(t, "1", r.Query.Get("x"))
+	assert.Equal(t, "example.com:8080", r.Host)
+
+	// Test: absolute-form takes its host over the Host header
+	r, err = RequestFromReader(strings.NewReader("GET http://example.com/x?y=1 HTTP/1.1\r\nHost: other.test\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "/x", r.RequestLine.RequestTarget)
+	assert.Equal(t, "http", r.URL.Scheme)
+	assert.Equal(t, "example.com", r.URL.Host)
+	assert.Equal(t, "1", r.Query.Get("y"))
+	assert.Equal(t, "example.com", r.Host)
+
+	// Test: absolute-form without a path
+	r, err = RequestFromReader(strings.NewReader("GET https://example.com HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "/", r.RequestLine.RequestTarget)
+
+	// Test: authority-form for CONNECT
+	r, err = RequestFromReader(strings.NewReader("CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:443", r.RequestLine.RequestTarget)
+	assert.Equal(t, "example.com:443", r.URL.Host)
+	assert.Equal(t, "example.com:443", r.Host)
+
+	// Test: asterisk-form for OPTIONS
+	r, err = RequestFromReader(strings.NewReader("OPTIONS * HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "*", r.RequestLine.RequestTarget)
+	assert.Equal(t, "*", r.URL.Path)
+
+	// Test: Targets in the wrong form for their method, or malformed
+	for _, line := range []string{
+		"GET * HTTP/1.1",
+		"CONNECT /x HTTP/1.1",
+		"CONNECT example.com HTTP/1.1",
+		"CONNECT http://example.com:443/ HTTP/1.1",
+		"GET example.com:443 HTTP/1.1",
+		"GET http:///x HTTP/1.1",
+		"GET http://user@example.com/ HTTP/1.1",
+		"GET /x#frag HTTP/1.1",
+		"GET /a%zz HTTP/1.1",
+	} {
+		_, err := RequestFromReader(strings.NewReader(line + "\r\n\r\n"))
+		assert.ErrorIs(t, err, ErrorInvalidRequestTarget, "%q", line)
+	}
+
+	// Test: HTTP/1.1 requests must name a host; HTTP/1.0 ones need not
+	_, err = RequestFromReader(strings.NewReader("GET /a HTTP/1.1\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrorInvalidHost)
+	r, err = RequestFromReader(strings.NewReader("GET /a HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Empty(t, r.Host)
+
+	// Test: Host must be unambiguous
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: a.test\r\nHost: b.test\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrorInvalidHost)
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: a.test/evil\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrorInvalidHost)
+}
+
+func TestParseHeaders(t *testing.T) {
+	// Test: Standard Headers
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	host, ok := r.Headers.Get("host")
+	assert.True(t, ok)
+	assert.Equal(t, "localhost:42069", host)
+
+	userAgent, ok := r.Headers.Get("user-agent")
+	assert.True(t, ok)
+	assert.Equal(t, "curl/7.81.0", userAgent)
+
+	accept, ok := r.Headers.Get("accept")
+	assert.True(t, ok)
+	assert.Equal(t, "*/*", accept)
+
+	// Test: Malformed Header
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestParseBody(t *testing.T) {
+	// Test: Standard Body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+
+	// Test: Body shorter than reported content length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestFraming(t *testing.T) {
+	// Test: Headers that leave the body length in doubt are rejected
+	for headers, want := range map[string]error{
+		"Content-Length: 5,6\r\n":                                ErrorInvalidContentLength,
+		"Content-Length: 5\r\nContent-Length: 6\r\n":             ErrorInvalidContentLength,
+		"Content-Length: +5\r\n":                                 ErrorInvalidContentLength,
+		"Content-Length: -1\r\n":                                 ErrorInvalidContentLength,
+		"Content-Length: 0x5\r\n":                                ErrorInvalidContentLength,
+		"Content-Length: \r\n":                                   ErrorInvalidContentLength,
+		"Content-Length: 99999999999999999999\r\n":               ErrorInvalidContentLength,
+		"Transfer-Encoding: chunked\r\nContent-Length: 5\r\n":    ErrorAmbiguousFraming,
+		"Content-Length: 5\r\nTransfer-Encoding: chunked\r\n":    ErrorAmbiguousFraming,
+		"Transfer-Encoding: gzip, chunked\r\n":                   ErrorUnsupportedTransferEncoding,
+		"Transfer-Encoding: chunked\r\nTransfer-Encoding: x\r\n": ErrorUnsupportedTransferEncoding,
+		"Transfer-Encoding: identity\r\n":                        ErrorUnsupportedTransferEncoding,
+	} {
+		_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: a\r\n" + headers + "\r\nhello"))
+		assert.ErrorIs(t, err, want, "%q", headers)
+	}
+
+	// Test: Transfer-Encoding from an HTTP/1.0 client
+	_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrorAmbiguousFraming)
+
+	// Test: Repeated identical lengths are accepted
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5, 5\r\nContent-Length: 5\r\n\r\nhello"))
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Control characters in the request line
+	for _, line := range []string{"GET /a\nb HTTP/1.1", "GET /a\rb HTTP/1.1", "GET\t/ HTTP/1.1", "G(T / HTTP/1.1"} {
+		_, err := RequestFromReader(strings.NewReader(line + "\r\nHost: a\r\n\r\n"))
+		assert.ErrorIs(t, err, ErrorMalformedRequestLine, "%q", line)
+	}
+
+	// Test: Lines ended by a bare LF are rejected without waiting for a CRLF
+	waited := errors.New("waited for more data")
+	for data, want := range map[string]error{
+		"GET / HTTP/1.1\n":                ErrorMalformedRequestLine,
+		"GET / HTTP/1.1\nHost: a\n\n":     ErrorMalformedRequestLine,
+		"GET / HTTP/1.1\r\nHost: a\n":     headers.ErrorMalformedFieldLine,
+		"GET / HTTP/1.1\r\nHost: a\r\n\n": headers.ErrorMalformedFieldLine,
+	} {
+		_, err := RequestFromReader(io.MultiReader(strings.NewReader(data), iotest.ErrReader(waited)))
+		assert.ErrorIs(t, err, want, "%q", data)
+	}
+
+	// Test: A line feed hidden in a quoted chunk extension
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5;name=\"a\nb\"\r\nhello\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	assert.ErrorIs(t, err, ErrorMalformedChunkExtension)
+}
+
+func TestParseChunkedBody(t *testing.T) {
+	// Test: Chunked body with extensions and trailers
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"7;name=value;quoted=\"a;b\"\r\n, world\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", string(body))
+	checksum, ok := r.Trailers.Get("x-checksum")
+	assert.True(t, ok)
+	assert.Equal(t, "abc123", checksum)
+
+	// Test: Trailers may not carry framing, routing or auth fields
+	for _, field := range []string{"Content-Length: 5", "Transfer-Encoding: chunked", "Host: evil.test", "Authorization: Bearer x"} {
+		r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"5\r\nhello\r\n0\r\nX-Checksum: abc\r\n" + field + "\r\n\r\n"))
+		require.NoError(t, err)
+		_, err = r.ReadBody()
+		assert.ErrorIs(t, err, ErrorForbiddenTrailer, field)
+		assert.Equal(t, 0, r.Trailers.Len(), field)
+	}
+
+	// Test: Chunked body without trailers, uppercase hex size
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"A\r\n0123456789\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(body))
+
+	// Test: Malformed chunk size
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrorMalformedChunkSize)
+
+	// Test: Chunk size that would overflow
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"fffffffffffffffff\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrorMalformedChunkSize)
+
+	// Test: Chunk data longer than its declared size
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrorMalformedChunk)
+
+	// Test: Body ends before the final chunk
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestRequestLimits(t *testing.T) {
+	// Test: Request line longer than the initial read buffer
+	longPath := "/" + strings.Repeat("a", 4000)
+	reader := &chunkReader{
+		data:            "GET " + longPath + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 512,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, longPath, r.RequestLine.RequestTarget)
+
+	// Test: Request line over the limit
+	reader = &chunkReader{
+		data:            "GET " + longPath + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 512,
+	}
+	_, err = NewReader(reader, Options{MaxRequestLineBytes: 100}).ReadRequest()
+	require.ErrorIs(t, err, ErrorRequestLineTooLong)
+
+	// Test: Request line over the limit with no CRLF in sight
+	reader = &chunkReader{
+		data:            "GET " + longPath,
+		numBytesPerRead: 512,
+	}
+	_, err = NewReader(reader, Options{MaxRequestLineBytes: 100}).ReadRequest()
+	require.ErrorIs(t, err, ErrorRequestLineTooLong)
+
+	// Test: Header section over the byte limit
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost\r\nX-Big: " + strings.Repeat("b", 200) + "\r\n\r\n",
+		numBytesPerRead: 16,
+	}
+	_, err = NewReader(reader, Options{MaxHeaderBytes: 100}).ReadRequest()
+	require.ErrorIs(t, err, ErrorHeadersTooLarge)
+
+	// Test: The body and the next requests arriving with the headers do not
+	// count towards the header limit
+	body := strings.Repeat("x", 500)
+	data := "POST /a HTTP/1.1\r\nHost: localhost\r\nContent-Length: 500\r\n\r\n" + body +
+		"GET /b HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /c HTTP/1.1\r\nHost: localhost\r\n\r\n"
+	rr := NewReader(strings.NewReader(data), Options{MaxHeaderBytes: 200})
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	got, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, body, string(got))
+	for _, target := range []string{"/b", "/c"} {
+		r, err = rr.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, target, r.RequestLine.RequestTarget)
+	}
+
+	// Test: Too many header fields
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = NewReader(reader, Options{MaxHeaderCount: 2}).ReadRequest()
+	require.ErrorIs(t, err, ErrorHeadersTooLarge)
+
+	// Test: Exactly at the header count limit
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = NewReader(reader, Options{MaxHeaderCount: 3}).ReadRequest()
+	require.NoError(t, err)
+
+	// Test: Content-Length over the body limit
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\nhello world",
+		numBytesPerRead: 3,
+	}
+	_, err = NewReader(reader, Options{MaxBodyBytes: 10}).ReadRequest()
+	require.ErrorIs(t, err, ErrorBodyTooLarge)
+
+	// Test: Chunked body over the body limit
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nhello \r\n5\r\nworld\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader, Options{MaxBodyBytes: 10}).ReadRequest()
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrorBodyTooLarge)
+}
+
+func TestStreamingBody(t *testing.T) {
+	// Test: Body is read lazily, a few bytes at a time
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Content-Length: 26\r\n" +
+			"\r\n" +
+			"abcdefghijklmnopqrstuvwxyz",
+		numBytesPerRead: 5,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	p := make([]byte, 4)
+	n, err := io.ReadFull(r.Body, p)
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", string(p[:n]))
+	rest, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "efghijklmnopqrstuvwxyz", string(rest))
+
+	// Test: Request without a body reads as empty
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	// Test: Unread bodies are drained before the next request
+	reader = &chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n0\r\n\r\n" +
+			"POST /second HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"world",
+		numBytesPerRead: 7,
+	}
+	rr := NewReader(reader, Options{})
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(body))
+
+	// Test: Pipelined requests arriving in a single read
+	rr = NewReader(strings.NewReader(
+		"GET /a HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+			"POST /b HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc"+
+			"GET /c HTTP/1.1\r\nHost: localhost\r\n\r\n"), Options{})
+	for _, target := range []string{"/a", "/b", "/c"} {
+		r, err := rr.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, target, r.RequestLine.RequestTarget)
+	}
+	_, err = rr.ReadRequest()
+	require.Error(t, err)
+
+	// Test: Reading after Close fails
+	require.NoError(t, r.Body.Close())
+	_, err = r.Body.Read(p)
+	require.ErrorIs(t, err, ErrorBodyReadAfterClose)
+}
@@ -0,0 +1,19 @@
+package response
+
+import "ray8118/httpfromtcp/request"
+
+// Handler responds to an HTTP request. The server, the mux and every
+// middleware work in terms of Handler, so any of them can wrap the others.
+type Handler interface {
+	ServeHTTP(w *Writer, r *request.Request)
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as HTTP handlers.
+// If f is a function with the appropriate signature, HandlerFunc(f) is a
+// Handler that calls f.
+type HandlerFunc func(w *Writer, r *request.Request)
+
+// ServeHTTP calls f(w, r).
+func (f HandlerFunc) ServeHTTP(w *Writer, r *request.Request) {
+	f(w, r)
+}
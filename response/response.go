@@ -0,0 +1,535 @@
+// Package response writes HTTP/1.1 responses. It defines the Writer that
+// handlers respond through and the Handler interface they implement.
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"ray8118/httpfromtcp/headers"
+	"strconv"
+	"strings"
+)
+
+// writerState tracks which part of the response the Writer expects next.
+// A response is always status line, then headers, then body.
+type writerState int
+
+const (
+	stateStatusLine writerState = iota
+	stateHeaders
+	stateBody
+	stateFinished
+)
+
+// maxBufferedBody is how much body the Writer holds back while it waits to
+// learn the full length. Bodies that fit are sent with a Content-Length;
+// longer ones switch to chunked encoding.
+const maxBufferedBody = 4 << 10
+
+var ErrorStatusLineAlreadyWritten = fmt.Errorf("status line already written")
+var ErrorStatusLineNotWritten = fmt.Errorf("headers written before status line")
+var ErrorHeadersAlreadyWritten = fmt.Errorf("headers already written")
+var ErrorResponseFinished = fmt.Errorf("response already finished")
+var ErrorNotInformational = fmt.Errorf("not an informational status code")
+var ErrorContentLength = fmt.Errorf("body length does not match Content-Length")
+
+// Writer builds an HTTP response. The status line and headers are held back
+// until the body's framing is known: a body that is fully written by the
+// time the handler returns gets a Content-Length, while one that is flushed
+// or outgrows the buffer is sent with chunked transfer encoding.
+type Writer struct {
+	writer     io.Writer
+	header     *headers.Headers
+	trailers   *headers.Headers
+	state      writerState
+	status     StatusCode
+	statusLine []byte
+	keepAlive  bool
+	// committed is set once the status line and headers are on the wire;
+	// until then body writes are collected in buf.
+	committed bool
+	chunked   bool
+	buf       []byte
+	// contentLength is the length declared in the headers that were sent,
+	// or -1 if the body is not delimited by one; written counts the body
+	// bytes sent so far, so a handler cannot send more or less than that.
+	contentLength int64
+	written       int64
+	// suppressBody drops the body while keeping the headers that describe
+	// it, as a response to HEAD requires.
+	suppressBody bool
+	// http10 is set for HTTP/1.0 clients, which understand neither chunked
+	// encoding nor persistent connections unless asked for.
+	http10 bool
+}
+
+func NewWriter(writer io.Writer) *Writer {
+	return &Writer{
+		writer:        writer,
+		header:        headers.NewHeaders(),
+		trailers:      headers.NewHeaders(),
+		keepAlive:     true,
+		contentLength: -1,
+	}
+}
+
+// Header returns the header map that will be sent with the response.
+// Changes made after the headers have been sent have no effect.
+func (w *Writer) Header() *headers.Headers {
+	return w.header
+}
+
+// DeclareTrailer announces fields that will be sent after the body, listing
+// them in the Trailer header. Declaring a trailer makes the response chunked.
+// It must be called before the headers are sent.
+func (w *Writer) DeclareTrailer(names ...string) error {
+	if w.committed {
+		return ErrorHeadersAlreadyWritten
+	}
+	for _, name := range names {
+		w.header.Add("Trailer", name)
+	}
+	return nil
+}
+
+// Trailers returns the map of trailer fields sent once the body is complete.
+// Only fields announced with DeclareTrailer should be set.
+func (w *Writer) Trailers() *headers.Headers {
+	return w.trailers
+}
+
+// SuppressBody makes the writer send the status line and headers but drop the
+// body, as required when answering a HEAD request. Handlers can still write
+// the body they would send for GET; its length ends up in Content-Length.
+func (w *Writer) SuppressBody() {
+	w.suppressBody = true
+}
+
+// SetRequestProto tells the writer which HTTP version the client used. The
+// server calls it for every request. HTTP/1.0 clients never get chunked
+// encoding: a streamed body is instead delimited by closing the connection,
+// and trailers are dropped. Kept-alive HTTP/1.0 connections are announced
+// with "Connection: keep-alive".
+func (w *Writer) SetRequestProto(major, minor int) {
+	w.http10 = major == 1 && minor == 0
+}
+
+// SetKeepAlive controls whether the connection may be reused once this
+// response is complete. The server sets it from the request; handlers can
+// call SetKeepAlive(false) to force the connection closed. It must be called
+// before the headers are sent.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// KeepAlive reports whether the connection can be reused after this response:
+// the response was finished, the body is framed by Content-Length or chunked
+// encoding, and neither side asked to close.
+func (w *Writer) KeepAlive() bool {
+	return w.state == stateFinished && w.keepAlive
+}
+
+// Reset discards everything written so far so a different response can be
+// sent instead, such as an error page. It reports false, and changes
+// nothing, if the status line and headers are already on the wire.
+func (w *Writer) Reset() bool {
+	if w.committed {
+		return false
+	}
+	w.header = headers.NewHeaders()
+	w.trailers = headers.NewHeaders()
+	w.state = stateStatusLine
+	w.status = 0
+	w.statusLine = nil
+	w.buf = nil
+	return true
+}
+
+// Abort gives up on a response that can no longer be completed. Nothing more
+// is written, and the connection is not reused, so the client sees the
+// response cut short instead of a body that merely looks complete.
+func (w *Writer) Abort() {
+	w.state = stateFinished
+	w.keepAlive = false
+}
+
+func Respond200(w *Writer) {
+	body := []byte(`
+	<html>
+	<head>
+		<title>200 OK</title>
+	</head>
+	<body>
+		<h1>Success!</h1>
+		<p>Your request was an absolute banger.</p>
+	</body>
+	</html>
+	`)
+	h := GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "text/html")
+	w.WriteStatusLine(StatusOk)
+	w.WriteHeaders(*h)
+	w.WriteBody(body)
+}
+
+func Respond400(w *Writer) {
+	body := []byte(`
+<html>
+  <head>
+    <title>400 Bad Request</title>
+  </head>
+  <body>
+    <h1>Bad Request</h1>
+    <p>Your request honestly kinda sucked.</p>
+  </body>
+</html>
+	`)
+	h := GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "text/html")
+	w.WriteStatusLine(StatusBadRequest)
+	w.WriteHeaders(*h)
+	w.WriteBody(body)
+}
+
+func Respond404(w *Writer) {
+	body := []byte(`
+<html>
+  <head>
+    <title>404 Not found</title>
+  </head>
+  <body> 
+    <h1>Not found</h1>
+    <p>Your request honestly kinda sucked.</p>
+  </body>
+</html>
+	`)
+	h := GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "text/html")
+	w.WriteStatusLine(StatusNotFound)
+	w.WriteHeaders(*h)
+	w.WriteBody(body)
+}
+
+func Respond500(w *Writer) {
+	body := []byte(`
+<html>
+  <head>
+    <title>500 Internal Server Error</title>
+  </head>
+  <body>
+    <h1>Internal Server Error</h1>
+    <p>Okay, you know what? This one is on me.</p>
+  </body>
+</html>
+	`)
+	h := GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "text/html")
+	w.WriteStatusLine(StatusInternalServerError)
+	w.WriteHeaders(*h)
+	w.WriteBody(body)
+}
+
+func GetDefaultHeaders(contentLen int) *headers.Headers {
+	h := headers.NewHeaders()
+	h.Set("Content-Length", fmt.Sprintf("%d", contentLen))
+	h.Set("Content-Type", "text/plain")
+
+	return h
+}
+
+// JSON marshals the provided data strcuture to JSON, sets the
+// appropriate headers, and writes the response
+func (w *Writer) JSON(statusCode int, data interface{}) {
+	// Marshall the data into a JSON byte slice
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		// if marshalling fails, it's a server-side problem
+		// Wr send a 500 Internal Server Error
+		w.WriteStatusLine(StatusInternalServerError)
+		h := GetDefaultHeaders(0)
+		w.WriteHeaders(*h)
+		return
+	}
+
+	// Set the status line and headers
+	w.WriteStatusLine(StatusCode(statusCode))
+	h := GetDefaultHeaders(len(jsonData))
+	h.Set("Content-Type", "application/json")
+	w.WriteHeaders(*h)
+	// Write the JSON body
+	w.WriteBody(jsonData)
+
+}
+
+// WriteStatusLine sets the status line for statusCode with its standard
+// reason phrase. Unregistered codes are still accepted, with an empty reason
+// phrase, as long as they have three digits. It must be the first call on
+// the Writer and may only be made once.
+func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason sets the status line for statusCode with a custom
+// reason phrase.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
+	if w.state != stateStatusLine {
+		return ErrorStatusLineAlreadyWritten
+	}
+	if statusCode < 100 || statusCode > 999 {
+		return fmt.Errorf("invalid status code %d", statusCode)
+	}
+	if strings.ContainsAny(reason, "\r\n") {
+		return fmt.Errorf("invalid reason phrase %q", reason)
+	}
+
+	w.status = statusCode
+	w.statusLine = fmt.Appendf(nil, "HTTP/1.1 %d %s\r\n", statusCode, reason)
+	w.state = stateHeaders
+	return nil
+}
+
+// WriteInformational sends an interim 1xx response, such as 103 Early Hints
+// carrying Link fields, ahead of the final one. It may be called any number
+// of times until the final status line and headers are sent; h may be nil.
+// HTTP/1.0 clients do not understand interim responses, so nothing is sent
+// to them. 101 Switching Protocols is not supported.
+func (w *Writer) WriteInformational(statusCode StatusCode, h *headers.Headers) error {
+	if statusCode < 100 || statusCode > 199 || statusCode == StatusSwitchingProtocols {
+		return fmt.Errorf("%w: %d", ErrorNotInformational, statusCode)
+	}
+	if w.committed || w.state == stateFinished {
+		return ErrorHeadersAlreadyWritten
+	}
+	if w.http10 {
+		return nil
+	}
+	b := fmt.Appendf(nil, "HTTP/1.1 %d %s\r\n", statusCode, StatusText(statusCode))
+	if h != nil {
+		h.ForEach(func(n, v string) {
+			b = fmt.Appendf(b, "%s: %s\r\n", n, v)
+		})
+	}
+	b = append(b, "\r\n"...)
+	_, err := w.writer.Write(b)
+	return err
+}
+
+// WriteHeaders adds h to the writer's header map. It must follow
+// WriteStatusLine and may only be called once. If h fixes the framing with a
+// Content-Length or Transfer-Encoding, the headers are sent right away;
+// otherwise they wait until the body's framing is decided.
+func (w *Writer) WriteHeaders(h headers.Headers) error {
+	switch w.state {
+	case stateStatusLine:
+		return ErrorStatusLineNotWritten
+	case stateBody:
+		return ErrorHeadersAlreadyWritten
+	case stateFinished:
+		return ErrorResponseFinished
+	}
+	// Fields in h replace any values already set for the same names.
+	h.ForEach(func(n, v string) {
+		w.header.Delete(n)
+	})
+	h.ForEach(func(n, v string) {
+		w.header.Add(n, v)
+	})
+	w.state = stateBody
+
+	_, hasLength := w.header.Get("content-length")
+	if hasLength || w.header.HasToken("transfer-encoding", "chunked") {
+		return w.commit()
+	}
+	return nil
+}
+
+// startBody moves a writer that is still missing its status line or headers
+// on to the body, using a 200 OK and the writer's header map.
+func (w *Writer) startBody() error {
+	if w.state == stateStatusLine {
+		if err := w.WriteStatusLine(StatusOk); err != nil {
+			return err
+		}
+	}
+	if w.state == stateHeaders {
+		if _, ok := w.header.Get("content-type"); !ok {
+			w.header.Set("Content-Type", "text/plain")
+		}
+		w.state = stateBody
+	}
+	return nil
+}
+
+// hasBody reports whether the status line allows a response body.
+func (w *Writer) hasBody() bool {
+	return w.status >= 200 && w.status != StatusNoContent && w.status != StatusNotModified
+}
+
+// commit sends the status line and headers, fixing how the body is framed.
+// A handler-supplied Content-Length or chunked Transfer-Encoding is kept,
+// except on statuses that cannot have a body; declared trailers force
+// chunked encoding.
+func (w *Writer) commit() error {
+	h := w.header
+	if !w.hasBody() {
+		h.Delete("content-length")
+		h.Delete("transfer-encoding")
+	}
+	if w.http10 {
+		h.Delete("trailer")
+		h.Delete("transfer-encoding")
+	}
+	if _, ok := h.Get("trailer"); ok && w.hasBody() {
+		h.Delete("content-length")
+		h.Set("Transfer-Encoding", "chunked")
+	}
+	w.chunked = h.HasToken("transfer-encoding", "chunked")
+
+	// Without an explicit length the body can only be delimited by closing
+	// the connection, and a handler may ask for that directly.
+	length, hasLength := h.Get("content-length")
+	if hasLength && !w.chunked && w.hasBody() {
+		n, err := strconv.ParseInt(length, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid Content-Length %q", length)
+		}
+		w.contentLength = n
+	}
+	if w.hasBody() && !hasLength && !w.chunked || h.HasToken("connection", "close") {
+		w.keepAlive = false
+	}
+
+	b := append([]byte{}, w.statusLine...)
+	h.ForEach(func(n, v string) {
+		if strings.EqualFold(n, "connection") && !w.keepAlive {
+			return
+		}
+		b = fmt.Appendf(b, "%s: %s\r\n", n, v)
+	})
+	if !w.keepAlive {
+		b = fmt.Append(b, "Connection: close\r\n")
+	} else if w.http10 && !h.HasToken("connection", "keep-alive") {
+		b = fmt.Append(b, "Connection: keep-alive\r\n")
+	}
+	b = fmt.Append(b, "\r\n")
+	w.committed = true
+	_, err := w.writer.Write(b)
+	return err
+}
+
+// writeChunk sends p as-is or as a single chunk, depending on the framing.
+// Bytes beyond a declared Content-Length are refused, since the client
+// would read them as the start of the next response.
+func (w *Writer) writeChunk(p []byte) error {
+	if len(p) == 0 || w.suppressBody || !w.hasBody() {
+		return nil
+	}
+	if w.contentLength >= 0 && w.written+int64(len(p)) > w.contentLength {
+		return ErrorContentLength
+	}
+	w.written += int64(len(p))
+	if !w.chunked {
+		_, err := w.writer.Write(p)
+		return err
+	}
+	b := fmt.Appendf(nil, "%x\r\n", len(p))
+	b = append(b, p...)
+	b = append(b, "\r\n"...)
+	_, err := w.writer.Write(b)
+	return err
+}
+
+// WriteBody writes part of the response body. If the status line has not
+// been written yet, a 200 OK is used; if the headers have not, the writer's
+// header map is used, with a text/plain Content-Type unless one was set.
+// Small bodies are buffered so they can be sent with a Content-Length.
+func (w *Writer) WriteBody(p []byte) (int, error) {
+	if w.state == stateFinished {
+		return 0, ErrorResponseFinished
+	}
+	if err := w.startBody(); err != nil {
+		return 0, err
+	}
+	if w.committed {
+		if err := w.writeChunk(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > maxBufferedBody {
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends everything written so far. If the headers are still pending,
+// the response switches to chunked encoding, since its length is unknown.
+func (w *Writer) Flush() error {
+	if w.state == stateFinished {
+		return ErrorResponseFinished
+	}
+	if err := w.startBody(); err != nil {
+		return err
+	}
+	if !w.committed {
+		if _, ok := w.header.Get("content-length"); !ok && w.hasBody() && !w.http10 {
+			w.header.Set("Transfer-Encoding", "chunked")
+		}
+		if err := w.commit(); err != nil {
+			return err
+		}
+	}
+	buf := w.buf
+	w.buf = nil
+	if !w.hasBody() {
+		return nil
+	}
+	return w.writeChunk(buf)
+}
+
+// Finish completes the response once the handler is done: a response that
+// was never started becomes an empty 200 OK, a buffered body is sent with
+// its Content-Length, and a chunked body gets its last chunk and trailers.
+// A body shorter than the Content-Length it declared cannot be completed;
+// the response is aborted and ErrorContentLength returned.
+// The server calls it after the handler returns; handlers need not.
+func (w *Writer) Finish() error {
+	if w.state == stateFinished {
+		return nil
+	}
+	if err := w.startBody(); err != nil {
+		return err
+	}
+	if !w.committed {
+		if _, ok := w.header.Get("trailer"); (!ok || w.http10) && w.hasBody() {
+			w.header.Set("Content-Length", fmt.Sprintf("%d", len(w.buf)))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	w.state = stateFinished
+	if w.suppressBody {
+		return nil
+	}
+	if w.contentLength >= 0 && w.written < w.contentLength {
+		w.Abort()
+		return ErrorContentLength
+	}
+	if !w.chunked {
+		return nil
+	}
+
+	b := []byte("0\r\n")
+	w.trailers.ForEach(func(n, v string) {
+		b = fmt.Appendf(b, "%s: %s\r\n", n, v)
+	})
+	b = append(b, "\r\n"...)
+	_, err := w.writer.Write(b)
+	return err
+}
@@ -0,0 +1,319 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"ray8118/httpfromtcp/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStatusLine(t *testing.T) {
+	// Test: Registered codes use their standard reason phrase
+	for code, line := range map[StatusCode]string{
+		StatusNoContent:          "HTTP/1.1 204 No Content\r\n",
+		StatusFound:              "HTTP/1.1 302 Found\r\n",
+		StatusMethodNotAllowed:   "HTTP/1.1 405 Method Not Allowed\r\n",
+		StatusTooManyRequests:    "HTTP/1.1 429 Too Many Requests\r\n",
+		StatusServiceUnavailable: "HTTP/1.1 503 Service Unavailable\r\n",
+	} {
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		require.NoError(t, w.WriteStatusLine(code))
+		require.NoError(t, w.Finish())
+		assert.True(t, strings.HasPrefix(buf.String(), line), buf.String())
+	}
+
+	// Test: Unknown three-digit code still produces a valid line
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(599))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 599 \r\n"))
+
+	// Test: Custom reason phrase
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLineReason(StatusOk, "Totally Fine"))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 Totally Fine\r\n"))
+
+	// Test: Invalid codes and reasons are rejected
+	buf = &bytes.Buffer{}
+	require.Error(t, NewWriter(buf).WriteStatusLine(42))
+	require.Error(t, NewWriter(buf).WriteStatusLine(1000))
+	require.Error(t, NewWriter(buf).WriteStatusLineReason(StatusOk, "OK\r\nX-Injected: 1"))
+	assert.Empty(t, buf.String())
+}
+
+func TestWriterOrdering(t *testing.T) {
+	// Test: Body first sends an implicit 200 with default headers
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("X-Custom", "yes")
+	_, err := w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nX-Custom: yes\r\nContent-Type: text/plain\r\nContent-Length: 2\r\n\r\nhi", buf.String())
+
+	// Test: Body after the status line sends the header map
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCreated))
+	w.Header().Set("Content-Length", "2")
+	_, err = w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "HTTP/1.1 201 Created\r\n")
+	assert.Contains(t, buf.String(), "Content-Length: 2\r\n")
+	assert.True(t, w.KeepAlive())
+
+	// Test: Out-of-order calls are rejected and write nothing
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.ErrorIs(t, w.WriteHeaders(*GetDefaultHeaders(0)), ErrorStatusLineNotWritten)
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.ErrorIs(t, w.WriteStatusLine(StatusOk), ErrorStatusLineAlreadyWritten)
+	h := GetDefaultHeaders(0)
+	h.Delete("Content-Length")
+	require.NoError(t, w.WriteHeaders(*h))
+	require.ErrorIs(t, w.WriteHeaders(*h), ErrorHeadersAlreadyWritten)
+	require.NoError(t, w.Finish())
+	require.ErrorIs(t, w.WriteHeaders(*h), ErrorResponseFinished)
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("HTTP/1.1")))
+}
+
+func TestWriterFraming(t *testing.T) {
+	// Test: A small body gets a Content-Length
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.WriteBody([]byte("hello "))
+	w.WriteBody([]byte("world"))
+	require.NoError(t, w.Finish())
+	res, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), res.ContentLength)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "hello world", string(body))
+
+	// Test: Flushing switches to chunked encoding
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.WriteBody([]byte("hello "))
+	require.NoError(t, w.Flush())
+	w.WriteBody([]byte("world"))
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "\r\n6\r\nhello \r\n5\r\nworld\r\n0\r\n\r\n")
+	res, err = http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+	body, _ = io.ReadAll(res.Body)
+	assert.Equal(t, "hello world", string(body))
+
+	// Test: Outgrowing the buffer switches to chunked encoding
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	large := strings.Repeat("x", maxBufferedBody+1)
+	w.WriteBody([]byte(large))
+	require.NoError(t, w.Finish())
+	res, err = http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+	body, _ = io.ReadAll(res.Body)
+	assert.Equal(t, large, string(body))
+
+	// Test: Declared trailers are sent after the body
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	w.WriteBody([]byte("data"))
+	w.Trailers().Set("X-Checksum", "abc")
+	require.NoError(t, w.Finish())
+	res, err = http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	body, _ = io.ReadAll(res.Body)
+	assert.Equal(t, "data", string(body))
+	assert.Equal(t, "abc", res.Trailer.Get("X-Checksum"))
+
+	// Test: An untouched writer produces an empty 200
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.Finish())
+	res, err = http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, int64(0), res.ContentLength)
+	assert.True(t, w.KeepAlive())
+
+	// Test: 204 responses carry no body framing
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.WriteStatusLine(StatusNoContent)
+	require.NoError(t, w.Finish())
+	assert.NotContains(t, buf.String(), "content-length")
+	assert.True(t, w.KeepAlive())
+
+	// Test: Bodies written for 204 and 304 are dropped along with their framing
+	for _, status := range []int{204, 304} {
+		buf = &bytes.Buffer{}
+		w = NewWriter(buf)
+		w.JSON(status, nil)
+		require.NoError(t, w.Finish())
+		assert.Equal(t, fmt.Sprintf("HTTP/1.1 %d %s\r\nContent-Type: application/json\r\n\r\n", status, StatusText(StatusCode(status))), buf.String())
+		assert.True(t, w.KeepAlive())
+	}
+
+	// Test: Writing past a declared Content-Length is refused
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.WriteStatusLine(StatusOk)
+	require.NoError(t, w.WriteHeaders(*GetDefaultHeaders(3)))
+	_, err = w.WriteBody([]byte("abcd"))
+	assert.ErrorIs(t, err, ErrorContentLength)
+	_, err = w.WriteBody([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte("d"))
+	assert.ErrorIs(t, err, ErrorContentLength)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nabc"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: A body shorter than its Content-Length closes the connection
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.WriteStatusLine(StatusOk)
+	require.NoError(t, w.WriteHeaders(*GetDefaultHeaders(10)))
+	w.WriteBody([]byte("abc"))
+	assert.ErrorIs(t, w.Finish(), ErrorContentLength)
+	assert.False(t, w.KeepAlive())
+
+	// Test: HEAD responses may declare a length without a body
+	w = NewWriter(&bytes.Buffer{})
+	w.SuppressBody()
+	w.WriteStatusLine(StatusOk)
+	require.NoError(t, w.WriteHeaders(*GetDefaultHeaders(10)))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriterHTTP10(t *testing.T) {
+	// Test: A kept-alive HTTP/1.0 response says so
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetRequestProto(1, 0)
+	w.WriteBody([]byte("hi"))
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Connection: keep-alive\r\n")
+	assert.Contains(t, buf.String(), "Content-Length: 2\r\n")
+	assert.True(t, w.KeepAlive())
+
+	// Test: A streamed body is delimited by closing the connection
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestProto(1, 0)
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	w.WriteBody([]byte("hello "))
+	require.NoError(t, w.Flush())
+	w.WriteBody([]byte("world"))
+	w.Trailers().Set("X-Checksum", "abc")
+	require.NoError(t, w.Finish())
+	res, err := http.ReadResponse(bufio.NewReader(buf), &http.Request{Method: "GET", ProtoMajor: 1, ProtoMinor: 0})
+	require.NoError(t, err)
+	assert.Empty(t, res.TransferEncoding)
+	assert.Empty(t, res.Header.Get("Trailer"))
+	assert.True(t, res.Close)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "hello world", string(body))
+	assert.False(t, w.KeepAlive())
+
+	// Test: Trailers declared on a buffered body still get a Content-Length
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestProto(1, 0)
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	w.WriteBody([]byte("data"))
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Content-Length: 4\r\n")
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriterHeaderOrder(t *testing.T) {
+	// Test: Fields go out in the order they were set, with repeated names
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("X-First", "1")
+	w.Header().Add("Set-Cookie", "a=1")
+	w.Header().Add("Set-Cookie", "b=2")
+	w.Header().Set("X-Last", "2")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"X-First: 1\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"X-Last: 2\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", buf.String())
+
+	// Test: WriteHeaders replaces earlier values for the names it carries
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("X-Keep", "yes")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(*GetDefaultHeaders(2)))
+	w.WriteBody([]byte("ok"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"X-Keep: yes\r\n"+
+		"Content-Length: 2\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\nok", buf.String())
+}
+
+func TestWriteInformational(t *testing.T) {
+	// Test: Early hints go out ahead of the final response
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	hints := headers.NewHeaders()
+	hints.Add("Link", "</style.css>; rel=preload; as=style")
+	require.NoError(t, w.WriteInformational(StatusEarlyHints, hints))
+	require.NoError(t, w.WriteInformational(StatusContinue, nil))
+	w.WriteBody([]byte("ok"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\n"+
+		"Link: </style.css>; rel=preload; as=style\r\n"+
+		"\r\n"+
+		"HTTP/1.1 100 Continue\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 2\r\n"+
+		"\r\nok", buf.String())
+
+	// Test: Only 1xx codes other than 101 are accepted
+	for _, code := range []StatusCode{StatusOk, StatusSwitchingProtocols, 99} {
+		assert.ErrorIs(t, NewWriter(&bytes.Buffer{}).WriteInformational(code, nil), ErrorNotInformational)
+	}
+
+	// Test: Too late once the final headers are sent
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.Flush())
+	assert.ErrorIs(t, w.WriteInformational(StatusEarlyHints, nil), ErrorHeadersAlreadyWritten)
+
+	// Test: HTTP/1.0 clients get nothing
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestProto(1, 0)
+	require.NoError(t, w.WriteInformational(StatusEarlyHints, hints))
+	assert.Empty(t, buf.String())
+}
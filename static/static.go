@@ -0,0 +1,98 @@
+// Package static serves files from a directory on disk.
+package static
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+	"strings"
+)
+
+// Static serves files from the "static" directory. When routed through a
+// catch-all such as "/static/{path...}" it serves the captured path;
+// otherwise it strips the "/static" prefix from the request target.
+func Static(w *response.Writer, r *request.Request) {
+	relPath, ok := r.PathParams["path"]
+	if !ok {
+		relPath = strings.TrimPrefix(r.RequestLine.RequestTarget, "/static")
+	}
+	serveFile(w, "static", relPath)
+}
+
+// FileServer returns a handler that serves files from dir. Like Static, it
+// serves the path captured by a "{path...}" catch-all, or else the whole
+// request path, which suits a handler mounted with Mux.Mount.
+func FileServer(dir string) response.Handler {
+	return response.HandlerFunc(func(w *response.Writer, r *request.Request) {
+		relPath, ok := r.PathParams["path"]
+		if !ok {
+			relPath = r.RequestLine.RequestTarget
+		}
+		serveFile(w, dir, relPath)
+	})
+}
+
+// serveFile sends the file at relPath inside dir, or dir's index.html for
+// a directory.
+func serveFile(w *response.Writer, dir, relPath string) {
+	if relPath == "" || relPath == "/" {
+		relPath = "index.html"
+	}
+
+	// Always ensure a leading slash before joining
+	if !strings.HasPrefix(relPath, "/") {
+		relPath = "/" + relPath
+	}
+
+	// Cleaning a rooted path drops any ".." that would escape the directory.
+	path := filepath.Join(dir, filepath.FromSlash(pathpkg.Clean(relPath)))
+
+	fi, err := os.Stat(path)
+	if err == nil && fi.IsDir() {
+		path = filepath.Join(path, "index.html")
+		fmt.Println("Directory requested, serving:", path)
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		response.Respond404(w)
+		return
+	}
+	if err != nil {
+		response.Respond500(w)
+		return
+	}
+	defer f.Close()
+
+	stat, _ := f.Stat()
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	h := response.GetDefaultHeaders(int(stat.Size()))
+	h.Set("Content-Type", mimeType)
+	w.WriteStatusLine(response.StatusOk)
+	w.WriteHeaders(*h)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			w.WriteBody(buf[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading file: %v", err)
+			break
+		}
+	}
+}
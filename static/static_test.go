@@ -0,0 +1,97 @@
+package static
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ray8118/httpfromtcp/headers"
+	"ray8118/httpfromtcp/mux"
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve routes a GET for target through m and returns the parsed response.
+func serve(t *testing.T, m *mux.Mux, target string) (*http.Response, string) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	m.ServeHTTP(w, &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+		PathParams:  map[string]string{},
+	})
+	require.NoError(t, w.Finish())
+	res, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body)
+}
+
+// writeFile creates the file at path under dir, along with its parents.
+func writeFile(t *testing.T, dir, path, content string) {
+	t.Helper()
+	path = filepath.Join(dir, filepath.FromSlash(path))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestStatic(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "static/index.html", "<h1>home</h1>")
+	writeFile(t, dir, "static/css/theme/site.css", "body {}")
+	writeFile(t, dir, "secret.txt", "top secret")
+	t.Chdir(dir)
+
+	m := mux.NewMux()
+	m.HandleFunc("GET", "/static/{path...}", Static)
+
+	// Test: Files in nested directories are served through the catch-all
+	res, body := serve(t, m, "/static/css/theme/site.css")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "text/css; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Equal(t, "body {}", body)
+
+	// Test: A directory serves its index.html
+	res, body = serve(t, m, "/static/")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "<h1>home</h1>", body)
+
+	// Test: ".." segments cannot escape the directory
+	for _, target := range []string{"/static/../secret.txt", "/static/css/../../secret.txt", "/static/../../secret.txt"} {
+		res, body = serve(t, m, target)
+		assert.Equal(t, 404, res.StatusCode, target)
+		assert.NotContains(t, body, "top secret", target)
+	}
+
+	// Test: A missing file is a 404
+	res, _ = serve(t, m, "/static/css/missing.css")
+	assert.Equal(t, 404, res.StatusCode)
+}
+
+func TestFileServer(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "public/docs/guide.txt", "read me")
+	writeFile(t, dir, "secret.txt", "top secret")
+
+	m := mux.NewMux()
+	m.Handle("GET", "/files/{path...}", FileServer(filepath.Join(dir, "public")))
+
+	// Test: Nested files are served from the given directory
+	res, body := serve(t, m, "/files/docs/guide.txt")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "read me", body)
+
+	// Test: ".." segments cannot escape the directory
+	res, body = serve(t, m, "/files/../secret.txt")
+	assert.Equal(t, 404, res.StatusCode)
+	assert.NotContains(t, body, "top secret")
+}
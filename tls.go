@@ -0,0 +1,231 @@
+package httpfromtcp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// certPollInterval is how often ListenAndServeTLS checks its certificate
+// files for changes.
+const certPollInterval = 10 * time.Second
+
+var ErrorNoCertificates = fmt.Errorf("no TLS certificates configured")
+
+// CertificatePair names a PEM certificate chain and its private key on disk.
+type CertificatePair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertStore serves TLS certificates loaded from files. During each handshake
+// it picks the certificate matching the server name the client asked for
+// (SNI), so one server can answer for several hosts. Certificates can be
+// reloaded while the server runs; handshakes in progress keep the
+// certificate they started with.
+type CertStore struct {
+	// ErrorLog receives errors from automatic reloads. When nil, the log
+	// package's standard logger is used.
+	ErrorLog *log.Logger
+
+	pairs []CertificatePair
+
+	mu       sync.RWMutex
+	certs    []*tls.Certificate
+	modTimes []time.Time
+}
+
+// NewCertStore loads the given certificate pairs. The first one is used for
+// clients that send no server name or one that matches no certificate.
+func NewCertStore(pairs ...CertificatePair) (*CertStore, error) {
+	if len(pairs) == 0 {
+		return nil, ErrorNoCertificates
+	}
+	s := &CertStore{pairs: pairs}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads every certificate pair from disk again. If any of them fails
+// to load, the certificates in use are kept and the error is returned.
+func (s *CertStore) Reload() error {
+	certs := make([]*tls.Certificate, len(s.pairs))
+	modTimes := make([]time.Time, len(s.pairs))
+	for i, pair := range s.pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", pair.CertFile, err)
+		}
+		certs[i] = &cert
+		modTimes[i] = s.modTime(pair)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certs = certs
+	s.modTimes = modTimes
+	return nil
+}
+
+// modTime returns the later modification time of a pair's two files.
+func (s *CertStore) modTime(pair CertificatePair) time.Time {
+	var latest time.Time
+	for _, name := range []string{pair.CertFile, pair.KeyFile} {
+		if fi, err := os.Stat(name); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
+
+// changed reports whether any file was modified since it was last loaded.
+func (s *CertStore) changed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i, pair := range s.pairs {
+		if !s.modTime(pair).Equal(s.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CertStore) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// GetCertificate picks the certificate for a handshake. It is meant for
+// tls.Config.GetCertificate.
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if hello.ServerName != "" {
+		for _, cert := range s.certs {
+			if hello.SupportsCertificate(cert) == nil {
+				return cert, nil
+			}
+		}
+	}
+	return s.certs[0], nil
+}
+
+// Watch checks the certificate files every interval and reloads them when
+// one has changed. Failed reloads are logged and retried on the next
+// change. Calling the returned function stops watching.
+func (s *CertStore) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if !s.changed() {
+				continue
+			}
+			if err := s.Reload(); err != nil {
+				s.logf("Reloading certificates: %v", err)
+			}
+		}
+	}()
+	return sync.OnceFunc(func() { close(done) })
+}
+
+// ReloadOn reloads the certificates whenever the process receives one of
+// sigs, typically syscall.SIGHUP. Calling the returned function stops
+// listening for them.
+func (s *CertStore) ReloadOn(sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ch:
+			}
+			if err := s.Reload(); err != nil {
+				s.logf("Reloading certificates: %v", err)
+			}
+		}
+	}()
+	return sync.OnceFunc(func() {
+		signal.Stop(ch)
+		close(done)
+	})
+}
+
+// tlsConfig builds the TLS configuration for ServeTLS. Certificates from
+// certFile and keyFile, if given, are loaded into a CertStore that is
+// watched for changes until the server stops.
+func (s *Server) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+
+	if certFile != "" || keyFile != "" {
+		store, err := NewCertStore(CertificatePair{CertFile: certFile, KeyFile: keyFile})
+		if err != nil {
+			return nil, err
+		}
+		store.ErrorLog = s.ErrorLog
+		config.GetCertificate = store.GetCertificate
+		s.onStop(store.Watch(certPollInterval))
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, ErrorNoCertificates
+	}
+	return config, nil
+}
+
+// ListenAndServeTLS is ListenAndServe over TLS. See ServeTLS for the
+// certificate arguments.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	l, err := s.listen(":https")
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(l, certFile, keyFile)
+}
+
+// ServeTLS is Serve over TLS. If certFile and keyFile are given, the
+// certificate is loaded from them and reloaded whenever either file changes.
+// Otherwise TLSConfig must provide the certificates, for example through a
+// CertStore's GetCertificate to choose between several by server name.
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	config, err := s.tlsConfig(certFile, keyFile)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	return s.Serve(tls.NewListener(l, config))
+}
+
+// ListenAndServeTLS listens on addr and serves requests over TLS with the
+// certificate in certFile and keyFile, using the same defaults as
+// ListenAndServe.
+func ListenAndServeTLS(addr, certFile, keyFile string, handler Handler) error {
+	return newDefaultServer(addr, handler).ListenAndServeTLS(certFile, keyFile)
+}
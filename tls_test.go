@@ -0,0 +1,155 @@
+package httpfromtcp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ray8118/httpfromtcp/request"
+	"ray8118/httpfromtcp/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a fresh self-signed certificate for host into dir and
+// returns the file names and the certificate's serial number.
+func writeCert(t *testing.T, dir, host string) (CertificatePair, *big.Int) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pair := CertificatePair{
+		CertFile: filepath.Join(dir, host+".crt"),
+		KeyFile:  filepath.Join(dir, host+".key"),
+	}
+	require.NoError(t, os.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return pair, serial
+}
+
+// fetch makes a request over TLS for serverName and returns the serial of
+// the certificate the server presented and the response body.
+func fetch(t *testing.T, addr, serverName string) (*big.Int, string) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: "+serverName+"\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber, string(body)
+}
+
+var helloTLS = HandlerFunc(func(w *response.Writer, r *request.Request) {
+	w.WriteBody([]byte("secure"))
+})
+
+func TestCertStore(t *testing.T) {
+	dir := t.TempDir()
+	a, serialA := writeCert(t, dir, "a.test")
+	b, serialB := writeCert(t, dir, "b.test")
+	store, err := NewCertStore(a, b)
+	require.NoError(t, err)
+
+	s := &Server{Handler: helloTLS, TLSConfig: &tls.Config{GetCertificate: store.GetCertificate}}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.ServeTLS(l, "", "")
+	defer s.Close()
+	addr := l.Addr().String()
+
+	// Test: The certificate is chosen by server name
+	serial, body := fetch(t, addr, "a.test")
+	assert.Equal(t, serialA, serial)
+	assert.Equal(t, "secure", body)
+	serial, _ = fetch(t, addr, "b.test")
+	assert.Equal(t, serialB, serial)
+
+	// Test: Unknown names get the first certificate
+	serial, _ = fetch(t, addr, "other.test")
+	assert.Equal(t, serialA, serial)
+
+	// Test: Reload picks up replaced files
+	_, newSerialB := writeCert(t, dir, "b.test")
+	require.NoError(t, store.Reload())
+	serial, _ = fetch(t, addr, "b.test")
+	assert.Equal(t, newSerialB, serial)
+
+	// Test: A broken file keeps the old certificate
+	require.NoError(t, os.WriteFile(b.KeyFile, []byte("garbage"), 0o600))
+	require.Error(t, store.Reload())
+	serial, _ = fetch(t, addr, "b.test")
+	assert.Equal(t, newSerialB, serial)
+
+	// Test: No certificates at all
+	_, err = NewCertStore()
+	assert.ErrorIs(t, err, ErrorNoCertificates)
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.ErrorIs(t, (&Server{}).ServeTLS(other, "", ""), ErrorNoCertificates)
+}
+
+func TestServeTLSFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	pair, serial := writeCert(t, dir, "a.test")
+
+	s := &Server{Handler: helloTLS}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.ServeTLS(l, pair.CertFile, pair.KeyFile)
+	defer s.Close()
+
+	// Test: Certificate files passed to ServeTLS
+	got, body := fetch(t, l.Addr().String(), "a.test")
+	assert.Equal(t, serial, got)
+	assert.Equal(t, "secure", body)
+
+	// Test: A watched store picks up changed files without a restart
+	store, err := NewCertStore(pair)
+	require.NoError(t, err)
+	stop := store.Watch(10 * time.Millisecond)
+	defer stop()
+	_, newSerial := writeCert(t, dir, "a.test")
+	// Make sure the modification time moves even on coarse filesystems.
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(pair.CertFile, later, later))
+	assert.Eventually(t, func() bool {
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{})
+		require.NoError(t, err)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return parsed.SerialNumber.Cmp(newSerial) == 0
+	}, time.Second, 10*time.Millisecond)
+}